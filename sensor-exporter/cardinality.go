@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// scrapeStatusFamilies are the per-collector families of scrapeStatus, which
+// are never dropped, so that every enabled collector, failing or not, keeps
+// reporting its status however many series the others invent.
+var scrapeStatusFamilies = map[string]bool{
+	"sensor_scrape_success":          true,
+	"sensor_scrape_duration_seconds": true,
+}
+
+// seriesLimitGatherer caps the number of distinct series served from a
+// Gatherer, so that a flapping drive id or a misbehaving chip can't flood the
+// Prometheus server with new series.  Series seen before keep being served;
+// once max distinct series have been seen, new ones are dropped and counted.
+type seriesLimitGatherer struct {
+	gatherer prometheus.Gatherer
+	max      int
+	dropped  prometheus.Counter
+
+	mu     sync.Mutex
+	known  map[string]bool
+	warned bool
+}
+
+// newSeriesLimitGatherer returns a gatherer serving at most max distinct
+// series from g.  Dropped series are counted by the returned counter, which
+// the caller registers.
+func newSeriesLimitGatherer(g prometheus.Gatherer, max int) (*seriesLimitGatherer, prometheus.Counter) {
+	dropped := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sensor_dropped_series_total",
+		Help: "number of series not served because -metric.max-series distinct series were already seen",
+	})
+	return &seriesLimitGatherer{
+		gatherer: g,
+		max:      max,
+		dropped:  dropped,
+		known:    make(map[string]bool),
+	}, dropped
+}
+
+// Gather implements prometheus.Gatherer.
+func (s *seriesLimitGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := s.gatherer.Gather()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := mfs[:0]
+	for _, mf := range mfs {
+		if scrapeStatusFamilies[mf.GetName()] {
+			kept = append(kept, mf)
+			continue
+		}
+		metrics := mf.Metric[:0]
+		for _, m := range mf.GetMetric() {
+			key := seriesKey(mf.GetName(), m)
+			if !s.known[key] {
+				if len(s.known) >= s.max {
+					s.drop(mf.GetName())
+					continue
+				}
+				s.known[key] = true
+			}
+			metrics = append(metrics, m)
+		}
+		if len(metrics) > 0 {
+			mf.Metric = metrics
+			kept = append(kept, mf)
+		}
+	}
+	return kept, err
+}
+
+// drop counts a dropped series of the named family, logging the first one.
+// The caller holds s.mu.
+func (s *seriesLimitGatherer) drop(name string) {
+	s.dropped.Inc()
+	if !s.warned {
+		slog.Warn("series limit reached, dropping new series; raise -metric.max-series if this is expected", "limit", s.max, "metric", name)
+		s.warned = true
+	}
+}
+
+// seriesKey identifies a series by its metric name and label pairs, which a
+// registry gathers sorted by name.
+func seriesKey(name string, m *dto.Metric) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, lp := range m.GetLabel() {
+		b.WriteByte(0xff)
+		b.WriteString(lp.GetName())
+		b.WriteByte('=')
+		b.WriteString(lp.GetValue())
+	}
+	return b.String()
+}
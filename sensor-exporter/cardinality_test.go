@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSeriesLimitKeepsScrapeStatus(t *testing.T) {
+	// Two hddtemp collectors whose daemon is down, so that every collector
+	// but the one filling the limit fails.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := ln.Addr().String()
+	ln.Close()
+
+	flood := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sensor_fake_series",
+		Help: "series filling the limit",
+	}, []string{"id"})
+	for i := 0; i < 10; i++ {
+		flood.WithLabelValues(strconv.Itoa(i)).Set(1)
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(flood,
+		NewHddCollector(down, time.Second, 0, 0),
+		NewHddCollector("unix:"+t.TempDir()+"/hddtemp.sock", time.Second, 0, 0))
+
+	limited, dropped := newSeriesLimitGatherer(registry, 5)
+	for scrape := 0; scrape < 2; scrape++ {
+		mfs, err := limited.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		families := make(map[string]int)
+		for _, mf := range mfs {
+			families[mf.GetName()] = len(mf.GetMetric())
+			if mf.GetName() == "sensor_scrape_success" {
+				for _, m := range mf.GetMetric() {
+					if v := m.GetGauge().GetValue(); v != 0 {
+						t.Errorf("sensor_scrape_success = %v for %v, want 0", v, m.GetLabel())
+					}
+				}
+			}
+		}
+		if got := families["sensor_fake_series"]; got != 5 {
+			t.Errorf("scrape %d: %d series of sensor_fake_series served, want the limit of 5", scrape, got)
+		}
+		for name := range scrapeStatusFamilies {
+			if got := families[name]; got != 2 {
+				t.Errorf("scrape %d: %d series of %s served, want 2", scrape, got, name)
+			}
+		}
+	}
+	if testutil.ToFloat64(dropped) == 0 {
+		t.Error("no series counted as dropped")
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectdSensors maps the collectd types written by its sensors plugin to
+// the metric they are exported as by the collectd collector: the lm-sensors
+// families shared with other collectors.  Humidity has no source label to
+// share it by, so it isn't exported.
+var collectdSensors = map[string]*prometheus.Desc{
+	"current":     newCurrentDesc("collectd"),
+	"fanspeed":    newFanspeedDesc("collectd"),
+	"power":       newPowerDesc("collectd"),
+	"temperature": newTemperatureDesc("collectd"),
+	"voltage":     newVoltageDesc("collectd"),
+}
+
+// CollectdCollector re-exports the readings of collectd's sensors plugin,
+// read from the socket of its unixsock plugin, for hosts where collectd
+// already reads lm-sensors.  Like NutCollector it connects afresh on every
+// scrape, so collectd may be started or restarted at any time.
+type CollectdCollector struct {
+	socket  string
+	host    string
+	timeout time.Duration
+	status  scrapeStatus
+}
+
+// NewCollectdCollector returns a collector for the collectd unixsock socket
+// at path socket, reading the values of the named host, or of every host
+// collectd has values for if host is empty.
+func NewCollectdCollector(socket, host string, timeout time.Duration) *CollectdCollector {
+	return &CollectdCollector{
+		socket:  socket,
+		host:    host,
+		timeout: timeout,
+		status:  newScrapeStatus("collectd", socket),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *CollectdCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range collectdSensors {
+		ch <- desc
+	}
+	c.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *CollectdCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := c.collect(ch)
+	if err != nil {
+		slog.Error("error collecting from collectd", "socket", c.socket, "err", err)
+	}
+	c.status.collect(ch, begin, err)
+}
+
+func (c *CollectdCollector) collect(ch chan<- prometheus.Metric) error {
+	conn, err := net.DialTimeout("unix", c.socket, c.timeout)
+	if err != nil {
+		return fmt.Errorf("error connecting to collectd socket '%s': %v", c.socket, err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return fmt.Errorf("error setting deadline on collectd socket '%s': %v", c.socket, err)
+	}
+
+	cc := &collectdClient{conn: conn, r: bufio.NewReader(conn)}
+	lines, err := cc.command("LISTVAL")
+	if err != nil {
+		return err
+	}
+	// The same reading of several hosts would be the same series.
+	seen := make(map[collectdIdentifier]bool)
+	for _, line := range lines {
+		// <last update time> <identifier>
+		_, identifier, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		id, ok := parseCollectdIdentifier(identifier)
+		if !ok || id.plugin != "sensors" || c.host != "" && id.host != c.host {
+			continue
+		}
+		desc, ok := collectdSensors[id.typ]
+		if !ok {
+			continue
+		}
+		key := id
+		key.host = ""
+		if seen[key] {
+			slog.Debug("skipping collectd value already read for another host", "identifier", identifier)
+			continue
+		}
+		seen[key] = true
+
+		values, err := cc.command("GETVAL " + quoteCollectd(identifier))
+		if errors.Is(err, errCollectdReply) {
+			// The value may have expired since LISTVAL.
+			slog.Debug("skipping collectd value", "identifier", identifier, "err", err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		value, ok := parseCollectdValue(values)
+		if !ok {
+			slog.Debug("skipping collectd value", "identifier", identifier, "values", values)
+			continue
+		}
+		// The adaptor and device aren't part of the identifier.
+		ch <- prometheus.MustNewConstMetric(desc,
+			prometheus.GaugeValue,
+			value,
+			id.typeInstance, id.pluginInstance, "", "")
+	}
+	return nil
+}
+
+// collectdIdentifier is a value identifier as written by collectd,
+// host/plugin[-plugin_instance]/type[-type_instance].  For the sensors
+// plugin, the plugin instance is the chip name and the type instance the
+// feature label, or name if the plugin doesn't use labels.
+type collectdIdentifier struct {
+	host, plugin, pluginInstance, typ, typeInstance string
+}
+
+func parseCollectdIdentifier(s string) (collectdIdentifier, bool) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return collectdIdentifier{}, false
+	}
+	id := collectdIdentifier{host: parts[0]}
+	id.plugin, id.pluginInstance, _ = strings.Cut(parts[1], "-")
+	id.typ, id.typeInstance, _ = strings.Cut(parts[2], "-")
+	return id, true
+}
+
+// quoteCollectd quotes an identifier for the unixsock protocol, since the
+// feature labels of the sensors plugin may contain spaces.
+func quoteCollectd(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// parseCollectdValue returns the value of a GETVAL reply, lines such as
+// "value=4.200000e+01", one per data source.  The types of the sensors plugin
+// have the one data source "value".  collectd writes "nan" for a value it has
+// no reading of.
+func parseCollectdValue(lines []string) (float64, bool) {
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || name != "value" {
+			continue
+		}
+		fvalue, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(fvalue) || math.IsInf(fvalue, 0) {
+			return 0, false
+		}
+		return fvalue, true
+	}
+	return 0, false
+}
+
+// errCollectdReply is wrapped in the errors collectd replies with.
+var errCollectdReply = errors.New("collectd replied with an error")
+
+// collectdClient speaks the collectd unixsock protocol over a single
+// connection.
+type collectdClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// command sends cmd and returns the lines of the reply after its status
+// line, "<count> <message>", a negative count being an error.
+func (c *collectdClient) command(cmd string) ([]string, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\n", cmd); err != nil {
+		return nil, fmt.Errorf("error writing to collectd: %v", err)
+	}
+	status, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	count, message, _ := strings.Cut(status, " ")
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected reply from collectd to %s: %s", cmd, status)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("%w to %s: %s", errCollectdReply, cmd, message)
+	}
+	lines := make([]string, 0, n)
+	for ; n > 0; n-- {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func (c *collectdClient) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("error reading from collectd: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
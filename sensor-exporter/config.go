@@ -0,0 +1,439 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// knownCollectors maps each collector name to whether it is enabled by default.
+// Each has a -collector.<name> flag.
+var knownCollectors = map[string]bool{
+	"collectd":       false,
+	"cooling_device": true,
+	"drivetemp":      true,
+	"gpu":            false,
+	"hddtemp":        true,
+	"hwmon":          false,
+	"ipmi":           false,
+	"lm":             lmSupported,
+	"lm_json":        false,
+	"nut":            false,
+	"nvme":           false,
+	"power_supply":   true,
+	"rapl":           false,
+	"rpi":            false,
+	"smc":            smcSupported,
+	"thermal_zone":   true,
+	"wmi":            false,
+}
+
+// Config is the document loaded from -config.file.  Settings that also have a
+// command-line flag are overridden by the flag when both are given.
+type Config struct {
+	Web struct {
+		ListenAddress   string        `yaml:"listen_address"`
+		TelemetryPath   string        `yaml:"telemetry_path"`
+		TelemetryAlias  []string      `yaml:"telemetry_alias"`
+		UpstreamURL     string        `yaml:"upstream_url"`
+		UpstreamTimeout time.Duration `yaml:"upstream_timeout"`
+		ReadTimeout     time.Duration `yaml:"read_timeout"`
+		WriteTimeout    time.Duration `yaml:"write_timeout"`
+		IdleTimeout     time.Duration `yaml:"idle_timeout"`
+		ConfigFile      string        `yaml:"config_file"`
+		LandingPage     string        `yaml:"landing_page"`
+		EnablePprof     bool          `yaml:"enable_pprof"`
+		DisableExporter bool          `yaml:"disable_exporter_metrics"`
+		EnableJSON      bool          `yaml:"enable_json"`
+		EnableRefresh   bool          `yaml:"enable_refresh"`
+	} `yaml:"web"`
+
+	// Collectors enables or disables collectors by name; collectors not
+	// listed keep their default.
+	Collectors map[string]bool `yaml:"collectors"`
+
+	// ExternalLabels are added to every metric, like -label.
+	ExternalLabels map[string]string `yaml:"external_labels"`
+
+	// Metrics overrides the help and adds labels to metric families, keyed
+	// by family name as served.  It has no flag equivalent.
+	Metrics map[string]MetricMetadata `yaml:"metrics"`
+
+	// Hddtemp's Timeout and StreamMaxAge are pointers so that 0 can be
+	// rejected rather than taken as unset.
+	Hddtemp struct {
+		Addresses       []string       `yaml:"addresses"`
+		Timeout         *time.Duration `yaml:"timeout"`
+		ResolveInterval time.Duration  `yaml:"resolve_interval"`
+		Stream          bool           `yaml:"stream"`
+		StreamMaxAge    *time.Duration `yaml:"stream_max_age"`
+	} `yaml:"hddtemp"`
+
+	// Nut's Timeout is a pointer so that 0 can be rejected rather than
+	// taken as unset.
+	Nut struct {
+		Address  string         `yaml:"address"`
+		Ups      []string       `yaml:"ups"`
+		Username string         `yaml:"username"`
+		Password string         `yaml:"password"`
+		Timeout  *time.Duration `yaml:"timeout"`
+	} `yaml:"nut"`
+
+	// Collectd's Timeout is a pointer so that 0 can be rejected rather
+	// than taken as unset.
+	Collectd struct {
+		Socket  string         `yaml:"socket"`
+		Host    string         `yaml:"host"`
+		Timeout *time.Duration `yaml:"timeout"`
+	} `yaml:"collectd"`
+
+	Sysfs struct {
+		SSHHosts   []string      `yaml:"ssh_hosts"`
+		SSHPath    string        `yaml:"ssh_path"`
+		SSHTimeout time.Duration `yaml:"ssh_timeout"`
+	} `yaml:"sysfs"`
+
+	LM struct {
+		ChipInclude    string        `yaml:"chip_include"`
+		ChipExclude    string        `yaml:"chip_exclude"`
+		FeatureExclude string        `yaml:"feature_exclude"`
+		CacheInterval  time.Duration `yaml:"cache_interval"`
+		SampleInterval time.Duration `yaml:"sample_interval"`
+		SampleIdle     time.Duration `yaml:"sample_idle_after"`
+		Watchdog       time.Duration `yaml:"watchdog_timeout"`
+
+		// ExemplarThreshold is a pointer since 0 is a valid threshold.
+		ExemplarThreshold *float64 `yaml:"exemplar_threshold"`
+
+		// Calibration corrects the readings of features, keyed by chip
+		// name, such as "it8728-isa-0a30", then by feature name, such as
+		// "temp1".  It has no flag equivalent.
+		Calibration map[string]map[string]Calibration `yaml:"calibration"`
+	} `yaml:"lm"`
+
+	// Pools maps pool names, such as a zfs pool or an md array, to the
+	// devices they are made of, such as "sda" or "/dev/nvme0".  It has no
+	// flag equivalent.
+	Pools map[string][]string `yaml:"pools"`
+}
+
+// Calibration corrects the readings of a feature with a known error to
+// value*Scale + Offset.  Scale defaults to 1.
+type Calibration struct {
+	Scale  float64 `yaml:"scale"`
+	Offset float64 `yaml:"offset"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *Calibration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type calibration Calibration
+	*c = Calibration{Scale: 1}
+	return unmarshal((*calibration)(c))
+}
+
+func (c Calibration) apply(value float64) float64 {
+	return value*c.Scale + c.Offset
+}
+
+// MetricMetadata overrides the help of a metric family and adds constant
+// labels to its series, as set in the metrics section of the config file.
+type MetricMetadata struct {
+	// Help replaces the family's help if set.  It is a pointer so that an
+	// empty help can be rejected.
+	Help   *string           `yaml:"help"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+// LoadConfig reads and validates the config file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file '%s': %v", path, err)
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("error parsing config file '%s': %v", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file '%s': %v", path, err)
+	}
+	return &c, nil
+}
+
+func (c *Config) validate() error {
+	if c.Web.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.Web.ListenAddress); err != nil {
+			return fmt.Errorf("web.listen_address: %v", err)
+		}
+	}
+	if c.Web.TelemetryPath != "" && !strings.HasPrefix(c.Web.TelemetryPath, "/") {
+		return fmt.Errorf("web.telemetry_path: must start with '/': %s", c.Web.TelemetryPath)
+	}
+	for i, alias := range c.Web.TelemetryAlias {
+		if !strings.HasPrefix(alias, "/") || strings.Contains(alias, ",") {
+			return fmt.Errorf("web.telemetry_alias[%d]: must start with '/' and not contain ',': %s", i, alias)
+		}
+	}
+	if c.Web.UpstreamTimeout < 0 {
+		return fmt.Errorf("web.upstream_timeout: must not be negative: %v", c.Web.UpstreamTimeout)
+	}
+	if c.Web.ReadTimeout < 0 || c.Web.WriteTimeout < 0 || c.Web.IdleTimeout < 0 {
+		return fmt.Errorf("web.read_timeout, web.write_timeout and web.idle_timeout: must not be negative")
+	}
+	for name := range c.Collectors {
+		if _, ok := knownCollectors[name]; !ok {
+			return fmt.Errorf("collectors.%s: unknown collector, expected one of %s", name, strings.Join(collectorNames(), ", "))
+		}
+	}
+	for name := range c.ExternalLabels {
+		if err := validateExtraLabel(name); err != nil {
+			return fmt.Errorf("external_labels.%s: %v", name, err)
+		}
+	}
+	for family, md := range c.Metrics {
+		if md.Help != nil && strings.TrimSpace(*md.Help) == "" {
+			return fmt.Errorf("metrics.%s.help: must not be empty", family)
+		}
+		for name := range md.Labels {
+			if err := validateExtraLabel(name); err != nil {
+				return fmt.Errorf("metrics.%s.labels.%s: %v", family, name, err)
+			}
+		}
+	}
+	for i, address := range c.Hddtemp.Addresses {
+		network, addr := hddtempNetwork(address)
+		if network == "unix" {
+			if addr == "" {
+				return fmt.Errorf("hddtemp.addresses[%d]: missing socket path", i)
+			}
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("hddtemp.addresses[%d]: %v", i, err)
+		}
+	}
+	if c.Hddtemp.Timeout != nil && *c.Hddtemp.Timeout <= 0 {
+		return fmt.Errorf("hddtemp.timeout: must be positive: %v", *c.Hddtemp.Timeout)
+	}
+	if c.Hddtemp.ResolveInterval < 0 {
+		return fmt.Errorf("hddtemp.resolve_interval: must not be negative: %v", c.Hddtemp.ResolveInterval)
+	}
+	if c.Hddtemp.StreamMaxAge != nil && *c.Hddtemp.StreamMaxAge <= 0 {
+		return fmt.Errorf("hddtemp.stream_max_age: must be positive: %v", *c.Hddtemp.StreamMaxAge)
+	}
+	if c.Nut.Address != "" {
+		if _, _, err := net.SplitHostPort(c.Nut.Address); err != nil {
+			return fmt.Errorf("nut.address: %v", err)
+		}
+	}
+	if c.Nut.Timeout != nil && *c.Nut.Timeout <= 0 {
+		return fmt.Errorf("nut.timeout: must be positive: %v", *c.Nut.Timeout)
+	}
+	if c.Collectd.Timeout != nil && *c.Collectd.Timeout <= 0 {
+		return fmt.Errorf("collectd.timeout: must be positive: %v", *c.Collectd.Timeout)
+	}
+	for i, host := range c.Sysfs.SSHHosts {
+		if host == "" || strings.HasPrefix(host, "-") || strings.Contains(host, ",") {
+			return fmt.Errorf("sysfs.ssh_hosts[%d]: must not be empty, start with '-' or contain ',': %s", i, host)
+		}
+	}
+	if c.Sysfs.SSHTimeout < 0 {
+		return fmt.Errorf("sysfs.ssh_timeout: must not be negative: %v", c.Sysfs.SSHTimeout)
+	}
+	if c.LM.CacheInterval < 0 {
+		return fmt.Errorf("lm.cache_interval: must not be negative: %v", c.LM.CacheInterval)
+	}
+	if c.LM.SampleInterval < 0 {
+		return fmt.Errorf("lm.sample_interval: must not be negative: %v", c.LM.SampleInterval)
+	}
+	if c.LM.Watchdog < 0 {
+		return fmt.Errorf("lm.watchdog_timeout: must not be negative: %v", c.LM.Watchdog)
+	}
+	if c.LM.SampleIdle < 0 {
+		return fmt.Errorf("lm.sample_idle_after: must not be negative: %v", c.LM.SampleIdle)
+	}
+	for chip, features := range c.LM.Calibration {
+		for feature, cal := range features {
+			if cal.Scale == 0 || math.IsNaN(cal.Scale) || math.IsInf(cal.Scale, 0) || math.IsNaN(cal.Offset) || math.IsInf(cal.Offset, 0) {
+				return fmt.Errorf("lm.calibration.%s.%s: scale must be finite and non-zero, offset finite", chip, feature)
+			}
+		}
+	}
+	for pool, devices := range c.Pools {
+		if len(devices) == 0 {
+			return fmt.Errorf("pools.%s: must list at least one device", pool)
+		}
+	}
+	if _, err := regexp.Compile(c.LM.ChipInclude); err != nil {
+		return fmt.Errorf("lm.chip_include: %v", err)
+	}
+	if _, err := regexp.Compile(c.LM.ChipExclude); err != nil {
+		return fmt.Errorf("lm.chip_exclude: %v", err)
+	}
+	if _, err := regexp.Compile(c.LM.FeatureExclude); err != nil {
+		return fmt.Errorf("lm.feature_exclude: %v", err)
+	}
+	return nil
+}
+
+func collectorNames() []string {
+	var names []string
+	for name := range knownCollectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagValues returns the settings of c that have a command-line flag, keyed
+// by flag name.
+func (c *Config) flagValues() map[string]string {
+	values := make(map[string]string)
+	for name, enabled := range c.Collectors {
+		values["collector."+name] = strconv.FormatBool(enabled)
+	}
+	if len(c.ExternalLabels) > 0 {
+		values["label"] = labelsFlag(c.ExternalLabels).String()
+	}
+	if c.Web.ListenAddress != "" {
+		values["web.listen-address"] = c.Web.ListenAddress
+	}
+	if c.Web.TelemetryPath != "" {
+		values["web.telemetry-path"] = c.Web.TelemetryPath
+	}
+	if len(c.Web.TelemetryAlias) > 0 {
+		values["web.telemetry-alias"] = strings.Join(c.Web.TelemetryAlias, ",")
+	}
+	if c.Web.UpstreamURL != "" {
+		values["web.upstream-url"] = c.Web.UpstreamURL
+	}
+	if c.Web.UpstreamTimeout != 0 {
+		values["web.upstream-timeout"] = c.Web.UpstreamTimeout.String()
+	}
+	if c.Web.ReadTimeout != 0 {
+		values["web.read-timeout"] = c.Web.ReadTimeout.String()
+	}
+	if c.Web.WriteTimeout != 0 {
+		values["web.write-timeout"] = c.Web.WriteTimeout.String()
+	}
+	if c.Web.IdleTimeout != 0 {
+		values["web.idle-timeout"] = c.Web.IdleTimeout.String()
+	}
+	if c.Web.ConfigFile != "" {
+		values["web.config.file"] = c.Web.ConfigFile
+	}
+	if c.Web.LandingPage != "" {
+		values["web.landing-page"] = c.Web.LandingPage
+	}
+	if c.Web.EnablePprof {
+		values["web.enable-pprof"] = "true"
+	}
+	if c.Web.DisableExporter {
+		values["web.disable-exporter-metrics"] = "true"
+	}
+	if c.Web.EnableJSON {
+		values["web.enable-json"] = "true"
+	}
+	if c.Web.EnableRefresh {
+		values["web.enable-refresh"] = "true"
+	}
+	if len(c.Hddtemp.Addresses) > 0 {
+		values["hddtemp-address"] = strings.Join(c.Hddtemp.Addresses, ",")
+	}
+	if c.Hddtemp.Timeout != nil {
+		values["hddtemp-timeout"] = c.Hddtemp.Timeout.String()
+	}
+	if c.Hddtemp.ResolveInterval != 0 {
+		values["hddtemp-resolve-interval"] = c.Hddtemp.ResolveInterval.String()
+	}
+	if c.Hddtemp.Stream {
+		values["hddtemp-stream"] = "true"
+	}
+	if c.Hddtemp.StreamMaxAge != nil {
+		values["hddtemp-stream-max-age"] = c.Hddtemp.StreamMaxAge.String()
+	}
+	if c.Nut.Address != "" {
+		values["nut.address"] = c.Nut.Address
+	}
+	if len(c.Nut.Ups) > 0 {
+		values["nut.ups"] = strings.Join(c.Nut.Ups, ",")
+	}
+	if c.Nut.Username != "" {
+		values["nut.username"] = c.Nut.Username
+	}
+	if c.Nut.Password != "" {
+		values["nut.password"] = c.Nut.Password
+	}
+	if c.Nut.Timeout != nil {
+		values["nut.timeout"] = c.Nut.Timeout.String()
+	}
+	if c.Collectd.Socket != "" {
+		values["collectd.socket"] = c.Collectd.Socket
+	}
+	if c.Collectd.Host != "" {
+		values["collectd.host"] = c.Collectd.Host
+	}
+	if c.Collectd.Timeout != nil {
+		values["collectd.timeout"] = c.Collectd.Timeout.String()
+	}
+	if len(c.Sysfs.SSHHosts) > 0 {
+		values["sysfs.ssh-hosts"] = strings.Join(c.Sysfs.SSHHosts, ",")
+	}
+	if c.Sysfs.SSHPath != "" {
+		values["sysfs.ssh-path"] = c.Sysfs.SSHPath
+	}
+	if c.Sysfs.SSHTimeout != 0 {
+		values["sysfs.ssh-timeout"] = c.Sysfs.SSHTimeout.String()
+	}
+	if c.LM.ChipInclude != "" {
+		values["lm.chip-include"] = c.LM.ChipInclude
+	}
+	if c.LM.ChipExclude != "" {
+		values["lm.chip-exclude"] = c.LM.ChipExclude
+	}
+	if c.LM.FeatureExclude != "" {
+		values["lm.feature-exclude"] = c.LM.FeatureExclude
+	}
+	if c.LM.CacheInterval != 0 {
+		values["lm.cache-interval"] = c.LM.CacheInterval.String()
+	}
+	if c.LM.SampleInterval != 0 {
+		values["lm.sample-interval"] = c.LM.SampleInterval.String()
+	}
+	if c.LM.Watchdog != 0 {
+		values["lm.watchdog-timeout"] = c.LM.Watchdog.String()
+	}
+	if c.LM.SampleIdle != 0 {
+		values["lm.sample-idle-after"] = c.LM.SampleIdle.String()
+	}
+	if c.LM.ExemplarThreshold != nil {
+		values["lm.exemplar-threshold"] = strconv.FormatFloat(*c.LM.ExemplarThreshold, 'g', -1, 64)
+	}
+	return values
+}
+
+// ApplyFlags sets every flag that wasn't given on the command line from c.
+func (c *Config) ApplyFlags() error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	for name, value := range c.flagValues() {
+		if given[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("error applying config to -%s: %v", name, err)
+		}
+	}
+	return nil
+}
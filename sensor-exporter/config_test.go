@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadConfigString loads a config file holding data.
+func loadConfigString(t *testing.T, data string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(path)
+}
+
+func TestLoadConfigCalibration(t *testing.T) {
+	c, err := loadConfigString(t, `
+lm:
+  calibration:
+    it8728-isa-0a30:
+      temp1: {offset: -5}
+      temp2: {scale: 2, offset: 1}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	features := c.LM.Calibration["it8728-isa-0a30"]
+	if got, want := features["temp1"], (Calibration{Scale: 1, Offset: -5}); got != want {
+		t.Errorf("temp1 calibration = %+v, want %+v", got, want)
+	}
+	if got, want := features["temp2"], (Calibration{Scale: 2, Offset: 1}); got != want {
+		t.Errorf("temp2 calibration = %+v, want %+v", got, want)
+	}
+	if got := features["temp2"].apply(50); got != 101 {
+		t.Errorf("temp2 calibration applied to 50 = %v, want 101", got)
+	}
+}
+
+func TestLoadConfigInvalidCalibration(t *testing.T) {
+	for _, cal := range []string{
+		"{scale: 0}",
+		"{scale: .nan}",
+		"{scale: .inf}",
+		"{scale: -.inf}",
+		"{offset: .nan}",
+		"{offset: .inf}",
+	} {
+		_, err := loadConfigString(t, "lm:\n  calibration:\n    it8728-isa-0a30:\n      temp1: "+cal+"\n")
+		if err == nil || !strings.Contains(err.Error(), "lm.calibration.it8728-isa-0a30.temp1") {
+			t.Errorf("calibration %s: LoadConfig() = %v, want an lm.calibration error", cal, err)
+		}
+	}
+}
+
+func TestLoadConfigSysfsSSH(t *testing.T) {
+	c, err := loadConfigString(t, `
+sysfs:
+  ssh_hosts: [node1, root@node2]
+  ssh_timeout: 5s
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := c.flagValues()
+	if got, want := values["sysfs.ssh-hosts"], "node1,root@node2"; got != want {
+		t.Errorf("-sysfs.ssh-hosts = %q, want %q", got, want)
+	}
+	if got, want := values["sysfs.ssh-timeout"], "5s"; got != want {
+		t.Errorf("-sysfs.ssh-timeout = %q, want %q", got, want)
+	}
+
+	for _, hosts := range []string{`[""]`, `["-oProxyCommand=x"]`, `["a,b"]`} {
+		_, err := loadConfigString(t, "sysfs:\n  ssh_hosts: "+hosts+"\n")
+		if err == nil || !strings.Contains(err.Error(), "sysfs.ssh_hosts[0]") {
+			t.Errorf("ssh_hosts %s: LoadConfig() = %v, want a sysfs.ssh_hosts error", hosts, err)
+		}
+	}
+}
+
+func TestLoadConfigHddtempTimeout(t *testing.T) {
+	c, err := loadConfigString(t, "hddtemp:\n  timeout: 5s\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.flagValues()["hddtemp-timeout"], "5s"; got != want {
+		t.Errorf("-hddtemp-timeout = %q, want %q", got, want)
+	}
+
+	for _, timeout := range []string{"0s", "-1s"} {
+		_, err := loadConfigString(t, "hddtemp:\n  timeout: "+timeout+"\n")
+		if err == nil || !strings.Contains(err.Error(), "hddtemp.timeout") {
+			t.Errorf("timeout %s: LoadConfig() = %v, want an hddtemp.timeout error", timeout, err)
+		}
+	}
+}
+
+func TestLoadConfigStreamMaxAge(t *testing.T) {
+	c, err := loadConfigString(t, "hddtemp:\n  stream: true\n  stream_max_age: 30s\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.flagValues()["hddtemp-stream-max-age"], "30s"; got != want {
+		t.Errorf("-hddtemp-stream-max-age = %q, want %q", got, want)
+	}
+
+	for _, maxAge := range []string{"0s", "-1s"} {
+		_, err := loadConfigString(t, "hddtemp:\n  stream_max_age: "+maxAge+"\n")
+		if err == nil || !strings.Contains(err.Error(), "hddtemp.stream_max_age") {
+			t.Errorf("stream_max_age %s: LoadConfig() = %v, want an hddtemp.stream_max_age error", maxAge, err)
+		}
+	}
+}
+
+func TestLoadConfigNutTimeout(t *testing.T) {
+	c, err := loadConfigString(t, "nut:\n  timeout: 5s\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.flagValues()["nut.timeout"], "5s"; got != want {
+		t.Errorf("-nut.timeout = %q, want %q", got, want)
+	}
+
+	for _, timeout := range []string{"0s", "-1s"} {
+		_, err := loadConfigString(t, "nut:\n  timeout: "+timeout+"\n")
+		if err == nil || !strings.Contains(err.Error(), "nut.timeout") {
+			t.Errorf("timeout %s: LoadConfig() = %v, want a nut.timeout error", timeout, err)
+		}
+	}
+}
+
+func TestLoadConfigCollectdTimeout(t *testing.T) {
+	c, err := loadConfigString(t, "collectd:\n  timeout: 5s\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.flagValues()["collectd.timeout"], "5s"; got != want {
+		t.Errorf("-collectd.timeout = %q, want %q", got, want)
+	}
+
+	for _, timeout := range []string{"0s", "-1s"} {
+		_, err := loadConfigString(t, "collectd:\n  timeout: "+timeout+"\n")
+		if err == nil || !strings.Contains(err.Error(), "collectd.timeout") {
+			t.Errorf("timeout %s: LoadConfig() = %v, want a collectd.timeout error", timeout, err)
+		}
+	}
+}
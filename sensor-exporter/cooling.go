@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/fs"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var coolingDeviceStateDesc = prometheus.NewDesc(
+	"sensor_cooling_device_state_ratio",
+	"current state of the cooling device relative to its maximum state, 1 meaning full cooling or throttling",
+	[]string{"device", "type"},
+	nil)
+
+// CoolingDeviceCollector exports the state of the kernel's thermal cooling
+// devices, such as fans and processor throttling, which shows active
+// throttling that temperatures alone don't.
+type CoolingDeviceCollector struct {
+	sysfs  sysfsTree
+	status scrapeStatus
+}
+
+// NewCoolingDeviceCollector returns a collector reading the cooling devices of
+// sysfs.
+func NewCoolingDeviceCollector(sysfs sysfsTree) *CoolingDeviceCollector {
+	return &CoolingDeviceCollector{
+		sysfs:  sysfs,
+		status: newScrapeStatus("cooling_device", sysfs.host()),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *CoolingDeviceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- coolingDeviceStateDesc
+	c.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *CoolingDeviceCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := c.collect(ch)
+	if err != nil {
+		slog.Error("error reading cooling devices", "err", err)
+	}
+	c.status.collect(ch, begin, err)
+}
+
+func (c *CoolingDeviceCollector) collect(ch chan<- prometheus.Metric) error {
+	fsys, err := c.sysfs.open()
+	if err != nil {
+		return err
+	}
+	dirs, err := fs.Glob(fsys, "class/thermal/cooling_device*")
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		maxState, err := readSysfsInt(fsys, path.Join(dir, "max_state"))
+		if err != nil || maxState <= 0 {
+			slog.Debug("skipping cooling device without a maximum state", "path", dir, "err", err)
+			continue
+		}
+		curState, err := readSysfsInt(fsys, path.Join(dir, "cur_state"))
+		if err != nil {
+			slog.Debug("skipping cooling device", "path", dir, "err", err)
+			continue
+		}
+		deviceType, err := readSysfsString(fsys, path.Join(dir, "type"))
+		if err != nil {
+			slog.Debug("skipping cooling device", "path", dir, "err", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(coolingDeviceStateDesc,
+			prometheus.GaugeValue,
+			float64(curState)/float64(maxState),
+			strings.TrimPrefix(path.Base(dir), "cooling_device"), deviceType)
+	}
+	return nil
+}
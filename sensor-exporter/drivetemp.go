@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var diskTempDesc = prometheus.NewDesc(
+	"sensor_disk_temperature_celsius",
+	"disk temperature in celsius as reported by the drivetemp hwmon driver",
+	[]string{"device"},
+	nil)
+
+// DrivetempCollector exports the SATA drive temperatures the kernel's
+// drivetemp driver reports through hwmon, without needing the hddtemp daemon.
+type DrivetempCollector struct {
+	sysfs  sysfsTree
+	status scrapeStatus
+}
+
+// NewDrivetempCollector returns a collector reading the hwmon devices of
+// sysfs.
+func NewDrivetempCollector(sysfs sysfsTree) *DrivetempCollector {
+	return &DrivetempCollector{
+		sysfs:  sysfs,
+		status: newScrapeStatus("drivetemp", sysfs.host()),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (d *DrivetempCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- diskTempDesc
+	d.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (d *DrivetempCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := d.collect(ch)
+	if err != nil {
+		slog.Error("error reading drivetemp sensors", "err", err)
+	}
+	d.status.collect(ch, begin, err)
+}
+
+func (d *DrivetempCollector) collect(ch chan<- prometheus.Metric) error {
+	fsys, err := d.sysfs.open()
+	if err != nil {
+		return err
+	}
+	dirs, err := fs.Glob(fsys, "class/hwmon/hwmon*")
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if name, err := readSysfsString(fsys, path.Join(dir, "name")); err != nil || name != "drivetemp" {
+			continue
+		}
+		millidegrees, err := readSysfsInt(fsys, path.Join(dir, "temp1_input"))
+		if err != nil {
+			slog.Debug("skipping drivetemp sensor", "path", dir, "err", err)
+			continue
+		}
+		device, err := blockDeviceName(fsys, dir)
+		if err != nil {
+			slog.Debug("skipping drivetemp sensor", "path", dir, "err", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(diskTempDesc,
+			prometheus.GaugeValue,
+			float64(millidegrees)/1000,
+			device)
+	}
+	return nil
+}
+
+// blockDeviceName returns the name, such as "sda", of the block device backing
+// a drivetemp hwmon directory.
+func blockDeviceName(fsys fs.FS, hwmonDir string) (string, error) {
+	entries, err := fs.ReadDir(fsys, path.Join(hwmonDir, "device/block"))
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("no block device found")
+	}
+	return entries[0].Name(), nil
+}
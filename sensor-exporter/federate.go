@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// federatingGatherer merges the metrics of an upstream exporter, such as a
+// node_exporter on the same host, into those gathered locally, so that
+// Prometheus has a single target to scrape.  Upstream families whose name is
+// also gathered locally, such as go_*, are dropped in favour of the local
+// ones.
+type federatingGatherer struct {
+	local  prometheus.Gatherer
+	url    string
+	client *http.Client
+	up     prometheus.Gauge
+}
+
+// newFederatingGatherer returns a gatherer merging the metrics served at url
+// into those of local.  The outcome of each fetch is reported by the
+// returned gauge, which the caller registers.
+func newFederatingGatherer(local prometheus.Gatherer, url string, timeout time.Duration) (*federatingGatherer, prometheus.Gauge) {
+	up := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sensor_upstream_up",
+		Help: "1 if the last fetch of the -web.upstream-url metrics succeeded, 0 otherwise",
+	})
+	return &federatingGatherer{
+		local:  local,
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		up:     up,
+	}, up
+}
+
+// Gather implements prometheus.Gatherer.  The upstream is fetched first, so
+// that sensor_upstream_up, gathered locally, reflects this very fetch.  A
+// failed fetch is logged and leaves only the local metrics.
+func (f *federatingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	upstream, err := f.fetch()
+	if err != nil {
+		slog.Error("error fetching upstream metrics", "url", f.url, "err", err)
+		f.up.Set(0)
+	} else {
+		f.up.Set(1)
+	}
+
+	mfs, err := f.local.Gather()
+	local := make(map[string]bool, len(mfs))
+	for _, mf := range mfs {
+		local[mf.GetName()] = true
+	}
+	for _, mf := range upstream {
+		if !local[mf.GetName()] {
+			mfs = append(mfs, mf)
+		}
+	}
+	sort.Slice(mfs, func(i, j int) bool {
+		return mfs[i].GetName() < mfs[j].GetName()
+	})
+	return mfs, err
+}
+
+func (f *federatingGatherer) fetch() ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var mfs []*dto.MetricFamily
+	dec := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+	for {
+		mf := &dto.MetricFamily{}
+		if err := dec.Decode(mf); err != nil {
+			if err == io.EOF {
+				return mfs, nil
+			}
+			return nil, err
+		}
+		mfs = append(mfs, mf)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	gpuTemperatureDesc = prometheus.NewDesc(
+		"sensor_gpu_temperature_celsius",
+		"GPU temperature in celsius",
+		[]string{"gpu", "name"},
+		nil)
+
+	gpuPowerDesc = prometheus.NewDesc(
+		"sensor_gpu_power_watts",
+		"GPU power draw in watts",
+		[]string{"gpu", "name"},
+		nil)
+
+	gpuFanSpeedDesc = prometheus.NewDesc(
+		"sensor_gpu_fan_speed_ratio",
+		"GPU fan speed as a ratio of its maximum",
+		[]string{"gpu", "name"},
+		nil)
+
+	// gpuQueryFields are the nvidia-smi fields read after index and name, with
+	// their metric and the factor converting them to base units.
+	gpuQueryFields = []struct {
+		field string
+		desc  *prometheus.Desc
+		scale float64
+	}{
+		{"temperature.gpu", gpuTemperatureDesc, 1},
+		{"power.draw", gpuPowerDesc, 1},
+		{"fan.speed", gpuFanSpeedDesc, 1e-2},
+	}
+)
+
+// GpuCollector exports NVIDIA GPU temperature, power draw and fan speed as
+// reported by nvidia-smi, none of which lm-sensors sees.
+type GpuCollector struct {
+	nvidiaSmi string
+	timeout   time.Duration
+	status    scrapeStatus
+}
+
+// NewGpuCollector returns a collector running the nvidia-smi binary, killed
+// if it takes longer than timeout, unless that is 0.
+func NewGpuCollector(nvidiaSmi string, timeout time.Duration) *GpuCollector {
+	return &GpuCollector{
+		nvidiaSmi: nvidiaSmi,
+		timeout:   timeout,
+		status:    newScrapeStatus("gpu", ""),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (g *GpuCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, f := range gpuQueryFields {
+		ch <- f.desc
+	}
+	g.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (g *GpuCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := g.collect(ch)
+	if err != nil {
+		slog.Error("error reading GPUs", "err", err)
+	}
+	g.status.collect(ch, begin, err)
+}
+
+func (g *GpuCollector) collect(ch chan<- prometheus.Metric) error {
+	query := []string{"index", "name"}
+	for _, f := range gpuQueryFields {
+		query = append(query, f.field)
+	}
+	ctx, cancel := collectContext(g.timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, g.nvidiaSmi,
+		"--query-gpu="+strings.Join(query, ","),
+		"--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return fmt.Errorf("error running %s: %v", g.nvidiaSmi, err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != len(query) {
+			slog.Debug("skipping unexpected nvidia-smi line", "line", line)
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		index, name := fields[0], fields[1]
+		for i, f := range gpuQueryFields {
+			// Fields a GPU doesn't support, such as the fan speed of a
+			// passively cooled card, read "[N/A]".
+			value, err := strconv.ParseFloat(fields[i+2], 64)
+			if err != nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(f.desc,
+				prometheus.GaugeValue,
+				value*f.scale,
+				index, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// hddtempStream reads the readings that a streaming hddtemp daemon writes on
+// a connection it keeps open, one per line, and remembers the latest.  A
+// daemon that writes nothing for maxAge fails the stream, so that a silent
+// daemon or a half-open connection doesn't keep serving an old reading.
+type hddtempStream struct {
+	conn   net.Conn
+	maxAge time.Duration
+	// ready is closed once the first reading or an error arrived.
+	ready chan struct{}
+
+	mu    sync.Mutex
+	frame string
+	err   error
+}
+
+func newHddtempStream(conn net.Conn, maxAge time.Duration) *hddtempStream {
+	s := &hddtempStream{conn: conn, maxAge: maxAge, ready: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+func (s *hddtempStream) run() {
+	defer s.conn.Close()
+	scanner := bufio.NewScanner(s.conn)
+	first := true
+	for {
+		if err := s.conn.SetReadDeadline(time.Now().Add(s.maxAge)); err != nil {
+			s.fail(first, err)
+			return
+		}
+		if !scanner.Scan() {
+			break
+		}
+		s.mu.Lock()
+		s.frame = scanner.Text()
+		s.mu.Unlock()
+		if first {
+			close(s.ready)
+			first = false
+		}
+	}
+	err := scanner.Err()
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = fmt.Errorf("no reading for %v", s.maxAge)
+	} else if err == nil {
+		err = errors.New("connection closed by hddtemp")
+	}
+	s.fail(first, err)
+}
+
+// fail records the error the stream failed with, waking up the scrape
+// waiting for the first reading if none arrived.
+func (s *hddtempStream) fail(first bool, err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	if first {
+		close(s.ready)
+	}
+}
+
+// latest returns the last reading, waiting up to timeout for the first one.
+// Once the connection failed, it returns the error.
+func (s *hddtempStream) latest(timeout time.Duration) (string, error) {
+	select {
+	case <-s.ready:
+	case <-time.After(timeout):
+		return "", fmt.Errorf("no reading within %v", timeout)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frame, s.err
+}
+
+func (s *hddtempStream) close() {
+	s.conn.Close()
+}
+
+// readTempsFromStream returns the latest reading of a streaming daemon,
+// connecting first if needed.  The connection is dropped on error, to be
+// reopened by the next scrape.
+func (h *HddCollector) readTempsFromStream() (string, error) {
+	h.streamMu.Lock()
+	defer h.streamMu.Unlock()
+	if h.stream == nil {
+		conn, err := h.connect()
+		if err != nil {
+			return "", err
+		}
+		h.stream = newHddtempStream(conn, h.streamMaxAge)
+	}
+	frame, err := h.stream.latest(h.timeout)
+	if err != nil {
+		h.stream.close()
+		h.stream = nil
+		return "", fmt.Errorf("error reading from hddtemp stream '%s': %v", h.address, err)
+	}
+	return frame, nil
+}
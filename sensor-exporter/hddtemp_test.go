@@ -0,0 +1,682 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseHddTemps(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		payload string
+		want    []HddTemperature
+		errs    int
+	}{
+		{
+			name:    "all good",
+			payload: "|/dev/sda|WDC WD10EZEX|35|C||/dev/sdb|ST4000DM004|38|C|",
+			want: []HddTemperature{
+				{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 35, Active: true},
+				{Device: "/dev/sdb", Id: "ST4000DM004", TemperatureCelsius: 38, Active: true},
+			},
+		},
+		{
+			name:    "all bad",
+			payload: "|/dev/sda|WDC WD10EZEX|35|K||/dev/sdb|ST4000DM004|hot|C||/dev/sdc|35|",
+			errs:    3,
+		},
+		{
+			name:    "mixed",
+			payload: "|/dev/sda|WDC WD10EZEX|35|K||/dev/sdb|ST4000DM004|38|C|",
+			want: []HddTemperature{
+				{Device: "/dev/sdb", Id: "ST4000DM004", TemperatureCelsius: 38, Active: true},
+			},
+			errs: 1,
+		},
+		{
+			name:    "empty",
+			payload: "",
+			errs:    1,
+		},
+		{
+			name:    "newline only",
+			payload: "\n",
+			errs:    1,
+		},
+		{
+			name:    "trailing newline",
+			payload: "|/dev/sda|WDC WD10EZEX|35|C|\n",
+			want:    []HddTemperature{{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 35, Active: true}},
+		},
+		{
+			name:    "garbled",
+			payload: "HTTP/1.1 400 Bad Request",
+			errs:    1,
+		},
+		{
+			name:    "integer temperature",
+			payload: "|/dev/sda|WDC WD10EZEX|36|C|",
+			want:    []HddTemperature{{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 36, Active: true}},
+		},
+		{
+			name:    "decimal temperature",
+			payload: "|/dev/sda|WDC WD10EZEX|36.5|C|",
+			want:    []HddTemperature{{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 36.5, Active: true}},
+		},
+		{
+			name:    "negative temperature",
+			payload: "|/dev/sda|WDC WD10EZEX|-5|C|",
+			want:    []HddTemperature{{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: -5, Active: true}},
+		},
+		{
+			name:    "hddtemp markers",
+			payload: "|/dev/sda|A|ERR|C||/dev/sdb|B|UNK|*||/dev/sdc|C|NA|C||/dev/sdd|D|NOS|*||/dev/sde|E|SLP|*|",
+			want: []HddTemperature{
+				{Device: "/dev/sda", Id: "A"},
+				{Device: "/dev/sdb", Id: "B"},
+				{Device: "/dev/sdc", Id: "C"},
+				{Device: "/dev/sdd", Id: "D"},
+				{Device: "/dev/sde", Id: "E"},
+			},
+		},
+		{
+			name:    "NaN temperature",
+			payload: "|/dev/sda|WDC WD10EZEX|NaN|C|",
+			errs:    1,
+		},
+		{
+			name:    "infinite temperature",
+			payload: "|/dev/sda|WDC WD10EZEX|Inf|C|",
+			errs:    1,
+		},
+		{
+			name:    "fahrenheit converted to celsius",
+			payload: "|/dev/sda|WDC WD10EZEX|95|F||/dev/sdb|ST4000DM004|-4|F|",
+			want: []HddTemperature{
+				{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 35, Active: true},
+				{Device: "/dev/sdb", Id: "ST4000DM004", TemperatureCelsius: -20, Active: true},
+			},
+		},
+		{
+			name:    "unreadable drive",
+			payload: "|/dev/sdc|DRIVE|*|*|",
+			want:    []HddTemperature{{Device: "/dev/sdc", Id: "DRIVE"}},
+		},
+		{
+			name:    "malformed unit",
+			payload: "|/dev/sda|WDC WD10EZEX|35|Celsius|",
+			errs:    1,
+		},
+		{
+			name:    "only the bad entry skipped",
+			payload: "|/dev/sda|WDC WD10EZEX|35|C||/dev/sdb|ST4000DM004|35|X||/dev/sdc|DRIVE|*|*||/dev/sdd|ST2000DM008|41|C|",
+			want: []HddTemperature{
+				{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 35, Active: true},
+				{Device: "/dev/sdc", Id: "DRIVE"},
+				{Device: "/dev/sdd", Id: "ST2000DM008", TemperatureCelsius: 41, Active: true},
+			},
+			errs: 1,
+		},
+		{
+			name:    "by-id device with a pipe in the id",
+			payload: "|/dev/disk/by-id/ata-Samsung_SSD_860_EVO_1TB_S3Z9NB0K123456A|Samsung SSD 860 EVO|1TB|33|C|",
+			want: []HddTemperature{{
+				Device:             "/dev/disk/by-id/ata-Samsung_SSD_860_EVO_1TB_S3Z9NB0K123456A",
+				Id:                 "Samsung SSD 860 EVO|1TB",
+				TemperatureCelsius: 33,
+				Active:             true,
+			}},
+		},
+		{
+			name:    "by-id device with several pipes in the id",
+			payload: "|/dev/disk/by-id/wwn-0x50014ee2b5a1c2d3|WDC|WD40EFRX|68N32N0|36|C||/dev/sdb|ST4000DM004|38|C|",
+			want: []HddTemperature{
+				{Device: "/dev/disk/by-id/wwn-0x50014ee2b5a1c2d3", Id: "WDC|WD40EFRX|68N32N0", TemperatureCelsius: 36, Active: true},
+				{Device: "/dev/sdb", Id: "ST4000DM004", TemperatureCelsius: 38, Active: true},
+			},
+		},
+		{
+			name:    "extra trailing field ignored",
+			payload: "|/dev/sda|WDC WD10EZEX|35|C|1|",
+			want:    []HddTemperature{{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 35, Active: true}},
+		},
+		{
+			name:    "several extra trailing fields ignored",
+			payload: "|/dev/sda|WDC WD10EZEX|35|C|SMART|194||/dev/sdb|ST4000DM004|38|C|",
+			want: []HddTemperature{
+				{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 35, Active: true},
+				{Device: "/dev/sdb", Id: "ST4000DM004", TemperatureCelsius: 38, Active: true},
+			},
+		},
+		{
+			// The last field being a unit, the fields before the last two are
+			// the id, even though the fourth field is a unit too.
+			name:    "unit in fourth and last fields read as pipes in the id",
+			payload: "|/dev/sda|WDC|35|C|104|F|",
+			want:    []HddTemperature{{Device: "/dev/sda", Id: "WDC|35|C", TemperatureCelsius: 40, Active: true}},
+		},
+		{
+			name:    "id field looking like a unit",
+			payload: "|/dev/sda|WDC|C|35|C|",
+			want:    []HddTemperature{{Device: "/dev/sda", Id: "WDC|C", TemperatureCelsius: 35, Active: true}},
+		},
+		{
+			name:    "sleeping drive among active ones",
+			payload: "|/dev/sda|WDC WD10EZEX|38|C||/dev/sdb|ST4000DM004|SLP|*|",
+			want: []HddTemperature{
+				{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 38, Active: true},
+				{Device: "/dev/sdb", Id: "ST4000DM004"},
+			},
+		},
+		{
+			name:    "frames of several daemons",
+			payload: "|/dev/sda|WDC WD10EZEX|35|C|\n|/dev/sdb|ST4000DM004|38|C|",
+			want: []HddTemperature{
+				{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 35, Active: true},
+				{Device: "/dev/sdb", Id: "ST4000DM004", TemperatureCelsius: 38, Active: true},
+			},
+		},
+		{
+			name:    "device repeated across frames kept as last listed",
+			payload: "|/dev/sda|WDC WD10EZEX|35|C|\n|/dev/sda|WDC WD10EZEX|36|C|",
+			want: []HddTemperature{
+				{Device: "/dev/sda", Id: "WDC WD10EZEX", TemperatureCelsius: 36, Active: true},
+			},
+		},
+		{
+			name:    "lone pipe",
+			payload: "|",
+			errs:    1,
+		},
+		{
+			name:    "unterminated frame",
+			payload: "|/dev/sda|WDC WD10EZEX|35|C",
+			errs:    1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, errs := parseHddTemps(tc.payload)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseHddTemps(%q) = %+v, want %+v", tc.payload, got, tc.want)
+			}
+			if len(errs) != tc.errs {
+				t.Errorf("parseHddTemps(%q) returned errors %v, want %d", tc.payload, errs, tc.errs)
+			}
+		})
+	}
+}
+
+// hddParseErrorKinds are the errors parseHddTemps returns or wraps.
+var hddParseErrorKinds = []error{ErrEmptyOutput, ErrBadFrame, ErrFieldCount, ErrBadUnit, ErrBadTemperature}
+
+func TestParseHddTempsErrorKinds(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		payload string
+		want    error
+	}{
+		{"empty output", "", ErrEmptyOutput},
+		{"whitespace output", " \r\n", ErrEmptyOutput},
+		{"garbled frame", "garbage", ErrBadFrame},
+		{"lone pipe", "|", ErrBadFrame},
+		{"missing unit", "|/dev/sda|WDC WD10EZEX|35|", ErrFieldCount},
+		{"unknown unit", "|/dev/sda|WDC WD10EZEX|35|K|", ErrBadUnit},
+		{"temperature not a number", "|/dev/sda|WDC WD10EZEX|hot|C|", ErrBadTemperature},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, errs := parseHddTemps(tc.payload)
+			if len(errs) != 1 {
+				t.Fatalf("parseHddTemps(%q) returned errors %v, want one", tc.payload, errs)
+			}
+			for _, kind := range hddParseErrorKinds {
+				if got, want := errors.Is(errs[0], kind), kind == tc.want; got != want {
+					t.Errorf("errors.Is(%v, %v) = %v, want %v", errs[0], kind, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHddParseOutcome(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		payload     string
+		wantErr     bool
+		parseErrors int
+	}{
+		{"empty output succeeds", "", false, 0},
+		{"newline only succeeds", "\n", false, 0},
+		{"trailing newline succeeds", "|/dev/sda|WDC WD10EZEX|35|C|\n", false, 0},
+		{"good entries succeed", "|/dev/sda|WDC WD10EZEX|35|C|", false, 0},
+		{"bad entry is skipped", "|/dev/sda|WDC WD10EZEX|35|C||/dev/sdb|ST4000|35|K|", false, 1},
+		{"bad frame is skipped", "|/dev/sda|WDC WD10EZEX|35|C|\ngarbage", false, 1},
+		{"bad entries alone fail", "|/dev/sda|WDC WD10EZEX|35|K||/dev/sdb|ST4000|hot|C|", true, 2},
+		{"bad frame alone fails", "garbage", true, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHddCollector("localhost:7634", time.Second, 0, 0)
+			err := h.parseOutcome(parseHddTemps(tc.payload))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("parseOutcome(%q) = %v, want error: %v", tc.payload, err, tc.wantErr)
+			}
+			if h.parseErrors != tc.parseErrors {
+				t.Errorf("parseOutcome(%q) counted %d parse errors, want %d", tc.payload, h.parseErrors, tc.parseErrors)
+			}
+		})
+	}
+}
+
+// fakeHddtemp is an hddtemp daemon listening on a random local port, or a
+// UNIX socket, that writes its payload to every client and closes the
+// connection, as hddtemp does.
+type fakeHddtemp struct {
+	ln   net.Listener
+	addr string
+
+	mu          sync.Mutex
+	payload     string
+	connections int
+}
+
+func newFakeHddtemp(t *testing.T, payload string) *fakeHddtemp {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveFakeHddtemp(t, ln, ln.Addr().String(), payload)
+}
+
+func newFakeHddtempUnix(t *testing.T, payload string) *fakeHddtemp {
+	path := filepath.Join(t.TempDir(), "hddtemp.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveFakeHddtemp(t, ln, "unix:"+path, payload)
+}
+
+func serveFakeHddtemp(t *testing.T, ln net.Listener, addr, payload string) *fakeHddtemp {
+	f := &fakeHddtemp{ln: ln, addr: addr, payload: payload}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.connections++
+			payload := f.payload
+			f.mu.Unlock()
+			conn.Write([]byte(payload))
+			conn.Close()
+		}
+	}()
+	return f
+}
+
+func (f *fakeHddtemp) setPayload(payload string) {
+	f.mu.Lock()
+	f.payload = payload
+	f.mu.Unlock()
+}
+
+func (f *fakeHddtemp) connectionCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connections
+}
+
+// gather registers c on a fresh registry and returns the families it
+// collects, by name.
+func gather(t *testing.T, c prometheus.Collector) map[string]*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	families := make(map[string]*dto.MetricFamily)
+	for _, mf := range mfs {
+		families[mf.GetName()] = mf
+	}
+	return families
+}
+
+// metricValues returns the values of the gauges and counters of a family
+// keyed by the value of label.
+func metricValues(mf *dto.MetricFamily, label string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, m := range mf.GetMetric() {
+		key := ""
+		for _, lp := range m.GetLabel() {
+			if lp.GetName() == label {
+				key = lp.GetValue()
+			}
+		}
+		if m.Gauge != nil {
+			values[key] = m.GetGauge().GetValue()
+		} else {
+			values[key] = m.GetCounter().GetValue()
+		}
+	}
+	return values
+}
+
+func TestHddCollectorInit(t *testing.T) {
+	f := newFakeHddtemp(t, "|/dev/sda|WDC WD10EZEX|35|C|")
+	h := NewHddCollector(f.addr, time.Second, 0, 0)
+	if err := h.Init(); err != nil {
+		t.Fatalf("Init() = %v", err)
+	}
+	if got := f.connectionCount(); got != 1 {
+		t.Errorf("Init() connected %d times, want 1", got)
+	}
+
+	f.ln.Close()
+	h = NewHddCollector(f.addr, time.Second, 0, 0)
+	if err := h.Init(); err == nil {
+		t.Error("Init() with the daemon down succeeded, want an error")
+	}
+}
+
+func TestHddCollectorCollect(t *testing.T) {
+	f := newFakeHddtemp(t, "|/dev/sda|WDC WD10EZEX|35|C|"+
+		"|/dev/sdb|ST4000DM004|95|F|"+
+		"|/dev/disk/by-id/wwn-0x50014ee2b5a1c2d3|WDC|WD40EFRX|36|C|"+
+		"|/dev/sdd|ST2000DM008|41|C|SMART|"+
+		"|/dev/sde|ST8000VN004|35|K|")
+	h := NewHddCollector(f.addr, time.Second, 0, 0)
+	families := gather(t, h)
+
+	temps := metricValues(families["sensor_hddsmart_temperature_celsius"], "device")
+	want := map[string]float64{
+		"/dev/sda":                               35,
+		"/dev/sdb":                               35,
+		"/dev/disk/by-id/wwn-0x50014ee2b5a1c2d3": 36,
+		"/dev/sdd":                               41,
+	}
+	if !reflect.DeepEqual(temps, want) {
+		t.Errorf("temperatures = %v, want %v", temps, want)
+	}
+	ids := metricValues(families["sensor_hddsmart_temperature_celsius"], "id")
+	if _, ok := ids["WDC|WD40EFRX"]; !ok {
+		t.Errorf("ids = %v, want one with a pipe", ids)
+	}
+	if up := metricValues(families["sensor_hddtemp_up"], "")[""]; up != 1 {
+		t.Errorf("sensor_hddtemp_up = %v, want 1", up)
+	}
+	if n := metricValues(families["sensor_hddtemp_parse_errors_total"], "")[""]; n != 1 {
+		t.Errorf("sensor_hddtemp_parse_errors_total = %v, want 1", n)
+	}
+}
+
+func TestHddCollectorEmptyOutput(t *testing.T) {
+	f := newFakeHddtemp(t, "")
+	h := NewHddCollector(f.addr, time.Second, 0, 0)
+	families := gather(t, h)
+
+	if _, ok := families["sensor_hddsmart_temperature_celsius"]; ok {
+		t.Error("temperatures served for empty output")
+	}
+	if up := metricValues(families["sensor_hddtemp_up"], "")[""]; up != 1 {
+		t.Errorf("sensor_hddtemp_up = %v, want 1", up)
+	}
+	if success := metricValues(families["sensor_scrape_success"], "")[""]; success != 1 {
+		t.Errorf("sensor_scrape_success = %v, want 1", success)
+	}
+}
+
+func TestHddCollectorDialsPerScrape(t *testing.T) {
+	f := newFakeHddtemp(t, "|/dev/sda|WDC WD10EZEX|35|C|")
+	h := NewHddCollector(f.addr, time.Second, 0, 0)
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(h)
+	for i := 1; i <= 3; i++ {
+		if _, err := registry.Gather(); err != nil {
+			t.Fatal(err)
+		}
+		if got := f.connectionCount(); got != i {
+			t.Errorf("after %d scrapes, %d connections, want %d", i, got, i)
+		}
+	}
+}
+
+func TestHddCollectorDriveActive(t *testing.T) {
+	f := newFakeHddtemp(t, "|/dev/sda|WDC WD10EZEX|38|C||/dev/sdb|ST4000DM004|SLP|*|")
+	h := NewHddCollector(f.addr, time.Second, 0, 0)
+	families := gather(t, h)
+
+	active := metricValues(families["sensor_hddsmart_drive_active"], "device")
+	if want := map[string]float64{"/dev/sda": 1, "/dev/sdb": 0}; !reflect.DeepEqual(active, want) {
+		t.Errorf("sensor_hddsmart_drive_active = %v, want %v", active, want)
+	}
+	temps := metricValues(families["sensor_hddsmart_temperature_celsius"], "device")
+	if want := map[string]float64{"/dev/sda": 38}; !reflect.DeepEqual(temps, want) {
+		t.Errorf("temperatures = %v, want %v", temps, want)
+	}
+}
+
+func TestHddCollectorReadsOnlyTheLatestReply(t *testing.T) {
+	f := newFakeHddtemp(t, "|/dev/sda|WDC WD10EZEX|35|C|")
+	h := NewHddCollector(f.addr, time.Second, 0, 0)
+	if _, err := h.readTempsFromConn(); err != nil {
+		t.Fatal(err)
+	}
+	f.setPayload("|/dev/sdb|ST4000DM004|38|C|")
+	got, err := h.readTempsFromConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "|/dev/sdb|ST4000DM004|38|C|"; got != want {
+		t.Errorf("second read = %q, want %q", got, want)
+	}
+}
+
+func TestHddCollectorUnixSocket(t *testing.T) {
+	f := newFakeHddtempUnix(t, "|/dev/sda|WDC WD10EZEX|35|C|")
+	h := NewHddCollector(f.addr, time.Second, time.Minute, 0)
+	families := gather(t, h)
+
+	temps := metricValues(families["sensor_hddsmart_temperature_celsius"], "device")
+	if want := map[string]float64{"/dev/sda": 35}; !reflect.DeepEqual(temps, want) {
+		t.Errorf("temperatures = %v, want %v", temps, want)
+	}
+	if got := f.connectionCount(); got != 1 {
+		t.Errorf("%d connections to the socket, want 1", got)
+	}
+}
+
+func TestHddCollectorBackoff(t *testing.T) {
+	h := NewHddCollector("hddtemp.example:7634", time.Second, 0, 0)
+	clock := time.Unix(1700000000, 0)
+	h.now = func() time.Time { return clock }
+	dials := 0
+	up := false
+	h.dialTimeout = func(network, address string, timeout time.Duration) (net.Conn, error) {
+		dials++
+		// The daemon comes up on the third dial.
+		if dials == 3 {
+			up = true
+		}
+		if !up {
+			return nil, errors.New("connection refused")
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+	connect := func() error {
+		conn, err := h.connect()
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	for _, step := range []struct {
+		advance time.Duration
+		dials   int
+		ok      bool
+	}{
+		{0, 1, false},
+		{0, 1, false}, // backing off 1s
+		{time.Second, 2, false},
+		{time.Second, 2, false}, // backing off 2s
+		{time.Second, 3, true},
+		{0, 4, true},
+	} {
+		clock = clock.Add(step.advance)
+		err := connect()
+		if ok := err == nil; ok != step.ok || dials != step.dials {
+			t.Fatalf("at %v: connect() = %v after %d dials, want ok %v after %d", clock, err, dials, step.ok, step.dials)
+		}
+	}
+
+	// The backoff was reset by the successful dial, doubles from 1s again
+	// and is capped at hddtempMaxBackoff.
+	up = false
+	var backoffs []time.Duration
+	for i := 0; i < 8; i++ {
+		if err := connect(); err == nil {
+			t.Fatal("connect() succeeded with the daemon down")
+		}
+		backoffs = append(backoffs, h.retryAt.Sub(clock))
+		clock = h.retryAt
+	}
+	want := []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		16 * time.Second, 32 * time.Second, time.Minute, time.Minute,
+	}
+	if !reflect.DeepEqual(backoffs, want) {
+		t.Errorf("backoffs = %v, want %v", backoffs, want)
+	}
+
+	// The error of the attempts skipped while backing off is the same
+	// throughout.
+	connect()
+	first := connect()
+	clock = clock.Add(time.Second)
+	if second := connect(); first == nil || second == nil || first.Error() != second.Error() {
+		t.Errorf("connect() = %v, then %v while backing off, want the same error", first, second)
+	}
+}
+
+func TestHddCollectorResolveCache(t *testing.T) {
+	h := NewHddCollector("hddtemp.example:7634", time.Second, 5*time.Minute, 0)
+	clock := time.Unix(1700000000, 0)
+	h.now = func() time.Time { return clock }
+	ip := "192.0.2.1"
+	lookups := 0
+	h.lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		lookups++
+		if host != "hddtemp.example" {
+			t.Errorf("looked up %q, want hddtemp.example", host)
+		}
+		return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+	}
+	var dialed []string
+	h.dialTimeout = func(network, address string, timeout time.Duration) (net.Conn, error) {
+		dialed = append(dialed, address)
+		if address != net.JoinHostPort(ip, "7634") {
+			return nil, errors.New("connection refused")
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+	connect := func() {
+		t.Helper()
+		conn, err := h.connect()
+		if err != nil {
+			t.Fatalf("connect() = %v", err)
+		}
+		conn.Close()
+	}
+
+	connect()
+	connect()
+	if lookups != 1 {
+		t.Errorf("%d lookups within the resolve interval, want 1", lookups)
+	}
+	clock = clock.Add(5 * time.Minute)
+	connect()
+	if lookups != 2 {
+		t.Errorf("%d lookups after the resolve interval, want 2", lookups)
+	}
+
+	// The host moves: the cached IP fails, and is looked up again within
+	// the same connection attempt.
+	ip = "192.0.2.2"
+	connect()
+	if lookups != 3 {
+		t.Errorf("%d lookups after the host moved, want 3", lookups)
+	}
+	want := []string{"192.0.2.1:7634", "192.0.2.1:7634", "192.0.2.1:7634", "192.0.2.1:7634", "192.0.2.2:7634"}
+	if !reflect.DeepEqual(dialed, want) {
+		t.Errorf("dialed %v, want %v", dialed, want)
+	}
+}
+
+func TestHddCollectorStreamGoneSilent(t *testing.T) {
+	// The daemon writes one reading to every client, then keeps the
+	// connection open without writing anything more.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			conn.Write([]byte("|/dev/sda|WDC WD10EZEX|35|C|\n"))
+		}
+	}()
+	connections := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(conns)
+	}
+
+	const maxAge = 100 * time.Millisecond
+	h := NewHddCollector(ln.Addr().String(), time.Second, 0, maxAge)
+	if up := metricValues(gather(t, h)["sensor_hddtemp_up"], "")[""]; up != 1 {
+		t.Fatalf("sensor_hddtemp_up = %v, want 1", up)
+	}
+	time.Sleep(3 * maxAge)
+	if up := metricValues(gather(t, h)["sensor_hddtemp_up"], "")[""]; up != 0 {
+		t.Errorf("sensor_hddtemp_up = %v with no reading for %v, want 0", up, 3*maxAge)
+	}
+	// The next scrape reconnects.
+	if up := metricValues(gather(t, h)["sensor_hddtemp_up"], "")[""]; up != 1 {
+		t.Errorf("sensor_hddtemp_up = %v after reconnecting, want 1", up)
+	}
+	if n := connections(); n != 2 {
+		t.Errorf("connected %d times, want 2", n)
+	}
+}
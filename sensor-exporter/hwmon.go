@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// hwmonSensors maps hwmon attribute name prefixes to the metric they are
+// exported as and the factor converting the attribute to the metric's unit.
+var hwmonSensors = map[string]struct {
+	desc  *prometheus.Desc
+	scale float64
+}{
+	"curr":  {newCurrentDesc("hwmon"), 1e-3},
+	"fan":   {newFanspeedDesc("hwmon"), 1},
+	"in":    {newVoltageDesc("hwmon"), 1e-3},
+	"power": {newPowerDesc("hwmon"), 1e-6},
+	"temp":  {newTemperatureDesc("hwmon"), 1e-3},
+}
+
+// HwmonCollector reads the kernel's hwmon devices directly from sysfs.  It
+// exports the same readings as the lm-sensors collector, with source="hwmon",
+// without needing libsensors or CGO.
+type HwmonCollector struct {
+	sysfs  sysfsTree
+	status scrapeStatus
+}
+
+// NewHwmonCollector returns a collector reading the hwmon devices of
+// sysfs.
+func NewHwmonCollector(sysfs sysfsTree) *HwmonCollector {
+	return &HwmonCollector{
+		sysfs:  sysfs,
+		status: newScrapeStatus("hwmon", sysfs.host()),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (h *HwmonCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, s := range hwmonSensors {
+		ch <- s.desc
+	}
+	h.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (h *HwmonCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := h.collect(ch)
+	if err != nil {
+		slog.Error("error reading hwmon devices", "err", err)
+	}
+	h.status.collect(ch, begin, err)
+}
+
+func (h *HwmonCollector) collect(ch chan<- prometheus.Metric) error {
+	fsys, err := h.sysfs.open()
+	if err != nil {
+		return err
+	}
+	dirs, err := fs.Glob(fsys, "class/hwmon/hwmon*")
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("no hwmon devices found")
+	}
+	for _, dir := range dirs {
+		name, err := readSysfsString(fsys, path.Join(dir, "name"))
+		if err != nil {
+			slog.Debug("skipping hwmon device", "path", dir, "err", err)
+			continue
+		}
+		chip, adaptor, device := hwmonChip(fsys, dir, name)
+		inputs, err := fs.Glob(fsys, path.Join(dir, "*_input"))
+		if err != nil {
+			return err
+		}
+		for _, input := range inputs {
+			feature := strings.TrimSuffix(path.Base(input), "_input")
+			s, ok := hwmonSensors[strings.TrimRight(feature, "0123456789")]
+			if !ok {
+				continue
+			}
+			value, err := readSysfsInt(fsys, input)
+			if err != nil {
+				slog.Debug("skipping hwmon attribute", "path", input, "err", err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(s.desc,
+				prometheus.GaugeValue,
+				float64(value)*s.scale,
+				hwmonLabel(fsys, dir, feature), chip, adaptor, device)
+		}
+	}
+	return nil
+}
+
+// hwmonDevice returns the name of the device a hwmon directory belongs to,
+// such as its PCI address, and the bus of that device.  Devices that have
+// none, such as acpitz, have an empty name and the "virtual" bus.
+func hwmonDevice(fsys fs.FS, dir string) (device, bus string) {
+	target, err := fs.ReadLink(fsys, path.Join(dir, "device"))
+	if err != nil {
+		return "", "virtual"
+	}
+	bus = "virtual"
+	if subsystem, err := fs.ReadLink(fsys, path.Join(dir, "device/subsystem")); err == nil {
+		bus = path.Base(subsystem)
+	}
+	return path.Base(target), bus
+}
+
+// hwmonChip names a hwmon device after the driver name and the device it
+// belongs to, e.g. "coretemp-coretemp.0", so that identical chips on
+// different devices stay apart.  The adaptor is the bus of the device.
+func hwmonChip(fsys fs.FS, dir, name string) (chip, adaptor, device string) {
+	device, adaptor = hwmonDevice(fsys, dir)
+	if device == "" {
+		return name + "-" + path.Base(dir), adaptor, device
+	}
+	return name + "-" + device, adaptor, device
+}
+
+// hwmonPwms returns the duty cycle of the pwm outputs of a hwmon directory,
+// such as "pwm1", from 0 to 1.  libsensors doesn't report them as features.
+func hwmonPwms(fsys fs.FS, dir string) map[string]float64 {
+	names, _ := fs.Glob(fsys, path.Join(dir, "pwm[0-9]*"))
+	pwms := make(map[string]float64)
+	for _, name := range names {
+		// Skip the pwmN_enable, pwmN_mode and other settings.
+		pwm := path.Base(name)
+		if strings.TrimLeft(pwm[len("pwm"):], "0123456789") != "" {
+			continue
+		}
+		value, err := readSysfsInt(fsys, name)
+		if err != nil {
+			slog.Debug("skipping pwm output", "path", name, "err", err)
+			continue
+		}
+		pwms[pwm] = float64(value) / 255
+	}
+	return pwms
+}
+
+// hwmonLabel returns the label of a feature such as "temp1", falling back to
+// the feature name as libsensors does.
+func hwmonLabel(fsys fs.FS, dir, feature string) string {
+	label, _ := readSysfsString(fsys, path.Join(dir, feature+"_label"))
+	return labelOrName(label, feature)
+}
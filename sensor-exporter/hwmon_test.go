@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestHwmonLabel(t *testing.T) {
+	fsys := fstest.MapFS{
+		"hwmon0/temp1_label": {Data: []byte("Package id 0\n")},
+		"hwmon0/temp3_label": {Data: []byte("\n")},
+	}
+	for feature, want := range map[string]string{
+		"temp1": "Package id 0",
+		"temp2": "temp2", // no label file
+		"temp3": "temp3", // empty label
+	} {
+		if got := hwmonLabel(fsys, "hwmon0", feature); got != want {
+			t.Errorf("hwmonLabel(%q) = %q, want %q", feature, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ipmiFanspeedDesc    = newFanspeedDesc("ipmi")
+	ipmiTemperatureDesc = newTemperatureDesc("ipmi")
+	ipmiVoltageDesc     = newVoltageDesc("ipmi")
+
+	// ipmiUnitDescs maps the units of `ipmitool sdr elist` readings to the
+	// metric family they are exported as.  Readings in other units are ignored.
+	ipmiUnitDescs = map[string]*prometheus.Desc{
+		"RPM":       ipmiFanspeedDesc,
+		"degrees C": ipmiTemperatureDesc,
+		"Volts":     ipmiVoltageDesc,
+	}
+)
+
+// IpmiCollector exports the baseboard fan, temperature and voltage sensors
+// read over IPMI by ipmitool, which lm-sensors often can't see.
+type IpmiCollector struct {
+	ipmitool string
+	timeout  time.Duration
+	status   scrapeStatus
+}
+
+// NewIpmiCollector returns a collector running the ipmitool binary, killed if
+// it takes longer than timeout, unless that is 0.
+func NewIpmiCollector(ipmitool string, timeout time.Duration) *IpmiCollector {
+	return &IpmiCollector{
+		ipmitool: ipmitool,
+		timeout:  timeout,
+		status:   newScrapeStatus("ipmi", ""),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (i *IpmiCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ipmiFanspeedDesc
+	ch <- ipmiTemperatureDesc
+	ch <- ipmiVoltageDesc
+	i.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (i *IpmiCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := i.collect(ch)
+	if err != nil {
+		slog.Error("error reading IPMI sensors", "err", err)
+	}
+	i.status.collect(ch, begin, err)
+}
+
+func (i *IpmiCollector) collect(ch chan<- prometheus.Metric) error {
+	ctx, cancel := collectContext(i.timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, i.ipmitool, "sdr", "elist").Output()
+	if err != nil {
+		return fmt.Errorf("error running %s: %v", i.ipmitool, err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		reading, ok := parseIpmiSensor(line)
+		if !ok {
+			continue
+		}
+		desc, ok := ipmiUnitDescs[reading.Unit]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(desc,
+			prometheus.GaugeValue,
+			reading.Value,
+			reading.Name, reading.Entity, "IPMI", "")
+	}
+	return nil
+}
+
+type ipmiReading struct {
+	Name   string
+	Entity string
+	Value  float64
+	Unit   string
+}
+
+// parseIpmiSensor parses a line of `ipmitool sdr elist` output such as
+//
+//	CPU Temp         | 30h | ok  |  3.1 | 38 degrees C
+//
+// Sensors without a reading, whose status is "ns" or "na", are skipped.
+func parseIpmiSensor(line string) (ipmiReading, bool) {
+	fields := strings.Split(line, "|")
+	if len(fields) != 5 {
+		return ipmiReading{}, false
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	name, status, entity, reading := fields[0], fields[2], fields[3], fields[4]
+	if status == "ns" || status == "na" {
+		return ipmiReading{}, false
+	}
+	value, unit, ok := strings.Cut(reading, " ")
+	if !ok {
+		return ipmiReading{}, false
+	}
+	fvalue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return ipmiReading{}, false
+	}
+	return ipmiReading{Name: name, Entity: entity, Value: fvalue, Unit: unit}, true
+}
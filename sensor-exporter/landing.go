@@ -0,0 +1,115 @@
+package main
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/prometheus/common/version"
+)
+
+const defaultLandingPage = `<html>
+<head><title>Sensor Exporter</title></head>
+<body>
+<h1>Sensor Exporter</h1>
+<p>{{.Version}}</p>
+<p><a href="{{.MetricsPath}}">Metrics</a></p>
+<h2>Collectors</h2>
+<table>
+<tr><th>Collector</th><th>Source</th><th>Status</th></tr>
+{{range .Collectors}}<tr><td>{{.Name}}</td><td>{{.Source}}</td><td>{{.Status}}</td></tr>
+{{end}}</table>
+{{if .JSON}}<p><a href="/sensors.json">Readings as JSON</a></p>
+{{end}}{{if .Pprof}}<p><a href="/debug/pprof/">Profiling</a></p>
+{{end}}</body>
+</html>
+`
+
+// landingPage serves an HTML status page from a template, which is given a
+// landingPageData.
+type landingPage struct {
+	tmpl        *template.Template
+	metricsPath string
+	enabled     map[string]bool
+	pprof       bool
+	json        bool
+}
+
+type landingPageData struct {
+	MetricsPath string
+	Version     string
+	Collectors  []landingPageCollector
+	Pprof       bool
+	JSON        bool
+}
+
+type landingPageCollector struct {
+	Name   string
+	Source string
+	Status string
+}
+
+// newLandingPage returns the landing page for the collectors enabled as
+// given, using the template in file, or the default one if file is empty.
+// pprof and json tell whether the profiling and JSON endpoints are served.
+func newLandingPage(file, metricsPath string, enabled map[string]bool, pprof, json bool) (*landingPage, error) {
+	text := defaultLandingPage
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	tmpl, err := template.New("landing").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &landingPage{tmpl: tmpl, metricsPath: metricsPath, enabled: enabled, pprof: pprof, json: json}, nil
+}
+
+func (p *landingPage) data() landingPageData {
+	results := scrapeResults.snapshot()
+	sort.Slice(results, func(i, j int) bool { return results[i].source < results[j].source })
+	var collectors []landingPageCollector
+	for _, name := range collectorNames() {
+		if !p.enabled[name] {
+			collectors = append(collectors, landingPageCollector{Name: name, Status: "disabled"})
+			continue
+		}
+		found := false
+		for _, r := range results {
+			if r.collector != name {
+				continue
+			}
+			found = true
+			collectors = append(collectors, landingPageCollector{Name: name, Source: r.source, Status: r.status()})
+		}
+		if !found {
+			collectors = append(collectors, landingPageCollector{Name: name, Status: "enabled"})
+		}
+	}
+	return landingPageData{
+		MetricsPath: p.metricsPath,
+		Version:     version.Info(),
+		Collectors:  collectors,
+		Pprof:       p.pprof,
+		JSON:        p.json,
+	}
+}
+
+// ServeHTTP implements http.Handler.  Only / is served, so that paths that
+// aren't handled, such as /debug/pprof/ when disabled, aren't mistaken for
+// the landing page.
+func (p *landingPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := p.tmpl.Execute(w, p.data()); err != nil {
+		slog.Error("error rendering landing page", "err", err)
+	}
+}
@@ -0,0 +1,156 @@
+//go:build linux && cgo
+
+package main
+
+/*
+#cgo LDFLAGS: -lsensors
+#include <stdio.h>
+#include <sensors/sensors.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/amkay/gosensors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lmSupported tells whether libsensors is available on this platform.
+const lmSupported = true
+
+// Init initializes libsensors with its default configuration.  gosensors.Init
+// discards the result of sensors_init, so it is called directly.  On failure,
+// the error is kept for the collector to report, and libsensors isn't read.
+func (l *LmSensorsCollector) Init() error {
+	if rc := C.sensors_init(nil); rc != 0 {
+		l.initErr = fmt.Errorf("error initializing libsensors: %s", C.GoString(C.sensors_strerror(rc)))
+	}
+	return l.initErr
+}
+
+// Cleanup releases the memory held by libsensors.  The collector must not be
+// used afterwards.
+func (l *LmSensorsCollector) Cleanup() {
+	l.stopSamplingAndWait()
+	gosensors.Cleanup()
+}
+
+// subFeatureValues returns the values of a feature's sub-features, keyed by
+// the part of their name after the feature name, e.g. "max" for "temp1_max".
+func subFeatureValues(feature gosensors.Feature) map[string]float64 {
+	values := make(map[string]float64)
+	for _, sf := range feature.GetSubFeatures() {
+		key := strings.TrimPrefix(sf.Name, feature.Name+"_")
+		values[key] = sf.GetValue()
+	}
+	return values
+}
+
+// featureLabel returns the label of a feature, or its name, such as "temp1",
+// for chips that don't define a label.
+func featureLabel(feature gosensors.Feature) string {
+	return labelOrName(feature.GetLabel(), feature.Name)
+}
+
+func (l *LmSensorsCollector) collect(ch chan<- prometheus.Metric) error {
+	chipsDetected := 0
+	for _, chip := range gosensors.GetDetectedChips() {
+		if l.collectChip(ch, chip) {
+			chipsDetected++
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(chipsDetectedDesc,
+		prometheus.GaugeValue,
+		float64(chipsDetected))
+	if chipsDetected == 0 {
+		return fmt.Errorf("no chips detected")
+	}
+	return nil
+}
+
+// collectChip sends the readings of a chip, reporting whether it was wanted
+// and read.  A panic reading the chip, such as gosensors choking on data a
+// broken chip returned, skips the rest of that chip only, and is counted in
+// l.chipErrors.  Faults in the C code itself can't be recovered from.
+func (l *LmSensorsCollector) collectChip(ch chan<- prometheus.Metric, chip gosensors.Chip) (read bool) {
+	name := chip.Prefix
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("error reading lm-sensors chip, skipping it", "chip", name, "err", r)
+			l.chipErrors[l.label(name)]++
+			read = false
+		}
+	}()
+	name = chip.String()
+	if !l.chipWanted(name) {
+		return false
+	}
+	chipName := l.label(name)
+	adaptorName := l.label(chip.AdapterName())
+	device, _ := hwmonDevice(hostRoot, strings.TrimPrefix(chip.Path, "/"))
+	features := chip.GetFeatures()
+	ch <- prometheus.MustNewConstMetric(featuresDetectedDesc,
+		prometheus.GaugeValue,
+		float64(len(features)),
+		chipName, device)
+	ch <- prometheus.MustNewConstMetric(chipInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		chipName, adaptorName, device,
+		busTypeName(chip.Bus.Type), strconv.Itoa(int(chip.Bus.Nr)), fmt.Sprintf("0x%04x", chip.Addr))
+	for _, feature := range features {
+		subsystem, ok := classifyFeature(feature.Name)
+		if !ok || !l.featureWanted(feature.Name) {
+			continue
+		}
+		s := lmSubsystems[subsystem]
+		value, ok := l.reading(name, feature.Name, subsystem, feature.GetValue(), chipName, device)
+		if !ok {
+			continue
+		}
+		featureLabel := l.label(featureLabel(feature))
+		ch <- prometheus.MustNewConstMetric(s.desc,
+			s.valueType,
+			value,
+			featureLabel, chipName, adaptorName, device)
+
+		subValues := subFeatureValues(feature)
+		for key, desc := range lmLimits[subsystem] {
+			if value, ok := subValues[key]; ok {
+				value = l.calibrate(name, feature.Name, value)
+				ch <- prometheus.MustNewConstMetric(desc,
+					prometheus.GaugeValue,
+					value,
+					featureLabel, chipName, adaptorName, device)
+			}
+		}
+		for key, value := range subValues {
+			if !isAlarmSubFeature(key) {
+				continue
+			}
+			alarm := 0.0
+			if value != 0 {
+				alarm = 1
+			}
+			ch <- prometheus.MustNewConstMetric(alarmDesc,
+				prometheus.GaugeValue,
+				alarm,
+				chipName, adaptorName, device, l.label(feature.Name+"_"+key))
+		}
+	}
+	for name, ratio := range hwmonPwms(hostRoot, strings.TrimPrefix(chip.Path, "/")) {
+		if !l.featureWanted(name) {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(fanPwmDesc,
+			prometheus.GaugeValue,
+			ratio,
+			chipName, adaptorName, device, l.label(name))
+	}
+	return true
+}
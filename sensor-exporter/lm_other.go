@@ -0,0 +1,23 @@
+//go:build !linux || !cgo
+
+package main
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lmSupported tells whether libsensors is available on this platform.  Builds
+// without cgo can use the lm_json collector instead.
+const lmSupported = false
+
+func (l *LmSensorsCollector) Init() error { return nil }
+
+func (l *LmSensorsCollector) Cleanup() {
+	l.stopSamplingAndWait()
+}
+
+func (l *LmSensorsCollector) collect(ch chan<- prometheus.Metric) error {
+	return errors.New("lm-sensors is only supported on Linux, in builds with cgo; use the lm_json collector instead")
+}
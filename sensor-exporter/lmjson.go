@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lmJSONSensors maps libsensors feature name prefixes to the metric they are
+// exported as by the lm_json collector: the lm-sensors families shared with
+// other collectors.
+var lmJSONSensors = map[string]*prometheus.Desc{
+	"curr":  newCurrentDesc("lm_json"),
+	"fan":   newFanspeedDesc("lm_json"),
+	"in":    newVoltageDesc("lm_json"),
+	"power": newPowerDesc("lm_json"),
+	"temp":  newTemperatureDesc("lm_json"),
+}
+
+// LmJSONCollector reads lm-sensors by running `sensors -j`, for builds
+// without cgo or hosts without the libsensors headers.  It exports the same
+// readings as the lm-sensors collector, with source="lm_json", at the cost of
+// running a process per scrape.
+type LmJSONCollector struct {
+	sensors     string
+	chipInclude *regexp.Regexp
+	chipExclude *regexp.Regexp
+	featExclude *regexp.Regexp
+	timeout     time.Duration
+	status      scrapeStatus
+}
+
+// NewLmJSONCollector returns a collector running the sensors binary, for the
+// chips and features chipInclude, chipExclude and featureExclude select as for
+// NewLmSensorsCollector.  sensors is killed if it takes longer than timeout,
+// unless that is 0.
+func NewLmJSONCollector(sensors string, chipInclude, chipExclude, featureExclude *regexp.Regexp, timeout time.Duration) *LmJSONCollector {
+	return &LmJSONCollector{
+		sensors:     sensors,
+		chipInclude: chipInclude,
+		chipExclude: chipExclude,
+		featExclude: featureExclude,
+		timeout:     timeout,
+		status:      newScrapeStatus("lm_json", ""),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (l *LmJSONCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range lmJSONSensors {
+		ch <- desc
+	}
+	l.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (l *LmJSONCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := l.collect(ch)
+	if err != nil {
+		slog.Error("error reading sensors -j", "err", err)
+	}
+	l.status.collect(ch, begin, err)
+}
+
+func (l *LmJSONCollector) collect(ch chan<- prometheus.Metric) error {
+	ctx, cancel := collectContext(l.timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, l.sensors, "-j").Output()
+	if err != nil {
+		return fmt.Errorf("error running %s -j: %v", l.sensors, err)
+	}
+	chips, err := parseSensorsJSON(out)
+	if err != nil {
+		return err
+	}
+	chipsDetected := 0
+	for _, chip := range chips {
+		if !chipWanted(l.chipInclude, l.chipExclude, chip.name) {
+			continue
+		}
+		chipsDetected++
+		for _, r := range chip.readings {
+			subsystem, ok := classifyFeature(r.feature)
+			if !ok || l.featExclude != nil && l.featExclude.MatchString(r.feature) {
+				continue
+			}
+			desc, ok := lmJSONSensors[subsystem]
+			if !ok {
+				continue
+			}
+			// The device isn't part of the output.
+			ch <- prometheus.MustNewConstMetric(desc,
+				prometheus.GaugeValue,
+				r.value,
+				r.label, chip.name, chip.adapter, "")
+		}
+	}
+	if chipsDetected == 0 {
+		return fmt.Errorf("no chips detected")
+	}
+	return nil
+}
+
+// sensorsChip is a chip as listed by `sensors -j`.
+type sensorsChip struct {
+	name, adapter string
+	readings      []sensorsReading
+}
+
+// sensorsReading is the input sub-feature of a feature, such as temp1_input,
+// as listed by `sensors -j`.
+type sensorsReading struct {
+	feature, label string
+	value          float64
+}
+
+// trailingCommas matches the commas lm-sensors 3.5.0 leaves before closing
+// braces, which make its output invalid JSON.
+var trailingCommas = regexp.MustCompile(`,(\s*})`)
+
+// parseSensorsJSON parses the output of `sensors -j`, an object keyed by chip
+// name whose values hold an "Adapter" string and one object per feature,
+// keyed by feature label, holding its sub-features, such as
+// {"temp1_input": 42.0, "temp1_max": 80.0}.  Sub-features that aren't numbers,
+// as some versions write for faults, are skipped.
+func parseSensorsJSON(out []byte) ([]sensorsChip, error) {
+	out = trailingCommas.ReplaceAll(out, []byte("$1"))
+	var doc map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(out, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing sensors -j output: %v", err)
+	}
+	var chips []sensorsChip
+	for name, fields := range doc {
+		chip := sensorsChip{name: name}
+		for label, raw := range fields {
+			if strings.EqualFold(label, "adapter") {
+				json.Unmarshal(raw, &chip.adapter)
+				continue
+			}
+			var subFeatures map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &subFeatures); err != nil {
+				slog.Debug("skipping sensors -j feature", "chip", name, "feature", label, "err", err)
+				continue
+			}
+			for key, raw := range subFeatures {
+				feature, ok := strings.CutSuffix(key, "_input")
+				if !ok {
+					continue
+				}
+				var value float64
+				if err := json.Unmarshal(raw, &value); err != nil {
+					slog.Debug("skipping sensors -j sub-feature", "chip", name, "sub-feature", key, "err", err)
+					continue
+				}
+				chip.readings = append(chip.readings, sensorsReading{feature: feature, label: label, value: value})
+			}
+		}
+		chips = append(chips, chip)
+	}
+	return chips, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var temperatureDistributionDesc = newFeatureDesc(
+	"sensor_lm_temperature_celsius_distribution",
+	"temperatures in celsius sampled every -lm.sample-interval since the previous scrape, with the minimum and maximum as the 0 and 1 quantiles",
+	"temptype", nil)
+
+var thresholdCrossingsDesc = newFeatureDesc(
+	"sensor_lm_temperature_threshold_crossings_total",
+	"number of times a temperature sampled every -lm.sample-interval rose to -lm.exemplar-threshold, with the event_id of the last crossing as exemplar",
+	"temptype", nil)
+
+// temperatureLabels are the variable labels of temperatureDesc, in order.
+var temperatureLabels = []string{"temptype", "chip", "adaptor", "device"}
+
+// temperatureSamples accumulates the temperatures read from one feature.
+type temperatureSamples struct {
+	labels   []string
+	count    uint64
+	sum      float64
+	min, max float64
+}
+
+// thresholdCrossings tracks one feature's temperature against the exemplar
+// threshold.  Unlike temperatureSamples, it is kept across scrapes.
+type thresholdCrossings struct {
+	labels []string
+	above  bool
+	count  uint64
+	// exemplar describes the last crossing.
+	exemplar prometheus.Exemplar
+}
+
+func (t *temperatureSamples) observe(value float64) {
+	if t.count == 0 || value < t.min {
+		t.min = value
+	}
+	if t.count == 0 || value > t.max {
+		t.max = value
+	}
+	t.count++
+	t.sum += value
+}
+
+// StartSampling reads the temperatures every interval in the background,
+// until Cleanup, so that the next scrape can report their distribution since
+// the previous one.  If idleAfter is not 0, sampling pauses while the
+// collector hasn't been scraped for that long, so that an exporter nobody
+// scrapes leaves the sensor bus alone.  Each time a sampled temperature rises
+// to threshold, a warning is logged with an event ID, which the crossing
+// counter carries as exemplar.  An infinite threshold disables this.
+func (l *LmSensorsCollector) StartSampling(interval, idleAfter time.Duration, threshold float64) {
+	l.samples = make(map[string]*temperatureSamples)
+	l.threshold = threshold
+	l.crossings = make(map[string]*thresholdCrossings)
+	l.stopSampling = make(chan struct{})
+	l.samplingDone = make(chan struct{})
+	go func() {
+		defer close(l.samplingDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stopSampling:
+				return
+			case <-ticker.C:
+				l.mu.Lock()
+				if idleAfter == 0 || time.Since(l.scrapedAt) < idleAfter {
+					l.sample()
+				}
+				l.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// stopSamplingAndWait stops the sampling started by StartSampling, if any.
+func (l *LmSensorsCollector) stopSamplingAndWait() {
+	if l.stopSampling == nil {
+		return
+	}
+	close(l.stopSampling)
+	<-l.samplingDone
+	l.stopSampling = nil
+}
+
+// sample reads libsensors once and records the temperatures.  The caller
+// holds l.mu.
+func (l *LmSensorsCollector) sample() {
+	if l.initErr != nil {
+		return
+	}
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := range ch {
+			if m.Desc() != temperatureDesc {
+				continue
+			}
+			var d dto.Metric
+			if err := m.Write(&d); err != nil {
+				continue
+			}
+			labels := make(map[string]string)
+			for _, lp := range d.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			values := make([]string, len(temperatureLabels))
+			for i, name := range temperatureLabels {
+				values[i] = labels[name]
+			}
+			key := strings.Join(values, "\xff")
+			s, ok := l.samples[key]
+			if !ok {
+				s = &temperatureSamples{labels: values}
+				l.samples[key] = s
+			}
+			s.observe(d.GetGauge().GetValue())
+			if !math.IsInf(l.threshold, 0) {
+				l.checkThreshold(key, values, d.GetGauge().GetValue())
+			}
+		}
+	}()
+	err := l.watchedCollect(ch)
+	close(ch)
+	<-done
+	if err != nil {
+		slog.Debug("error sampling lm-sensors", "err", err)
+	}
+}
+
+// checkThreshold records a sampled temperature of the feature identified by
+// key and labels against l.threshold.  The caller holds l.mu.
+func (l *LmSensorsCollector) checkThreshold(key string, labels []string, value float64) {
+	c, ok := l.crossings[key]
+	if !ok {
+		c = &thresholdCrossings{labels: labels}
+		l.crossings[key] = c
+	}
+	above := value >= l.threshold
+	if above && !c.above {
+		now := time.Now()
+		id := fmt.Sprintf("%x", now.UnixNano())
+		c.count++
+		c.exemplar = prometheus.Exemplar{
+			Value:     value,
+			Labels:    prometheus.Labels{"event_id": id},
+			Timestamp: now,
+		}
+		slog.Warn("temperature rose to the exemplar threshold",
+			"event_id", id, "temptype", labels[0], "chip", labels[1], "device", labels[3],
+			"celsius", value, "threshold", l.threshold)
+	}
+	c.above = above
+}
+
+// collectSamples sends the distribution of the temperatures sampled since the
+// previous call, and starts over.  The caller holds l.mu.
+func (l *LmSensorsCollector) collectSamples(ch chan<- prometheus.Metric) {
+	for key, s := range l.samples {
+		ch <- prometheus.MustNewConstSummary(temperatureDistributionDesc,
+			s.count, s.sum,
+			map[float64]float64{0: s.min, 1: s.max},
+			s.labels...)
+		delete(l.samples, key)
+	}
+	for _, c := range l.crossings {
+		m := prometheus.MustNewConstMetric(thresholdCrossingsDesc,
+			prometheus.CounterValue,
+			float64(c.count),
+			c.labels...)
+		if c.count > 0 {
+			m = prometheus.MustNewMetricWithExemplars(m, c.exemplar)
+		}
+		ch <- m
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// watchedCollect runs l.collect, recording when it started so that the
+// watchdog can tell a read stuck in libsensors.  The caller holds l.mu.
+func (l *LmSensorsCollector) watchedCollect(ch chan<- prometheus.Metric) error {
+	l.readingSince.Store(time.Now().UnixNano())
+	defer l.readingSince.Store(0)
+	return l.collect(ch)
+}
+
+// StartWatchdog checks in the background that no libsensors read, for a
+// scrape or a sample, takes longer than timeout.  A call into C can't be
+// interrupted, and libsensors can't be cleaned up or initialized again while
+// one is in progress, so a read stuck in it holds l.mu, and the scrapes
+// queued behind it, forever.  Nor can the goroutine stuck in it be stopped,
+// so the collector can't heal itself: the watchdog exits the process instead,
+// for its service manager to restart it, which changes
+// sensor_exporter_start_time_seconds.
+func (l *LmSensorsCollector) StartWatchdog(timeout time.Duration) {
+	go func() {
+		// A timeout of a few nanoseconds would make a tick of 0.
+		ticker := time.NewTicker(max(timeout/4, time.Millisecond))
+		defer ticker.Stop()
+		for range ticker.C {
+			since := l.readingSince.Load()
+			if since == 0 {
+				continue
+			}
+			if stalled := time.Since(time.Unix(0, since)); stalled > timeout {
+				slog.Error("lm-sensors read stalled, exiting to be restarted", "stalled", stalled, "timeout", timeout)
+				l.exit(1)
+				return
+			}
+		}
+	}()
+}
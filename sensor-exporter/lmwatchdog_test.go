@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	l := NewLmSensorsCollector(nil, nil, nil, 0, false, nil, nil)
+	l.initErr = errors.New("not initialized in tests")
+	exited := make(chan int, 1)
+	l.exit = func(code int) { exited <- code }
+
+	// A timeout of a few nanoseconds used to make a tick of 0, which
+	// panics.
+	l.StartWatchdog(3 * time.Nanosecond)
+	select {
+	case code := <-exited:
+		t.Fatalf("exited with status %d with no read in progress", code)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.readingSince.Store(time.Now().Add(-time.Minute).UnixNano())
+	select {
+	case code := <-exited:
+		if code != 1 {
+			t.Errorf("exited with status %d, want 1", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no exit for a stalled read")
+	}
+}
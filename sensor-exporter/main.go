@@ -2,247 +2,1553 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net"
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/amkay/gosensors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/version"
+	"github.com/prometheus/exporter-toolkit/web"
 )
 
 var (
-	fanspeedDesc = prometheus.NewDesc(
-		"sensor_lm_fan_speed_rpm",
-		"fan speed (rotations per minute).",
-		[]string{"fantype", "chip", "adaptor"},
+	// Energy features are cumulative, so they are exported as a counter.
+	// Chips reset the count on reboot; rate() treats that as a counter reset.
+	energyDesc = newFeatureDesc(
+		"sensor_lm_energy_joules_total",
+		"energy consumed in joules since the chip was reset",
+		"energytype", nil)
+
+	fanspeedDesc = newFanspeedDesc("lm")
+
+	voltageDesc = newVoltageDesc("lm")
+
+	powerDesc = newPowerDesc("lm")
+
+	chipsDetectedDesc = prometheus.NewDesc(
+		"sensor_lm_chips_detected",
+		"number of chips detected by libsensors, after chip filtering",
+		nil,
 		nil)
 
-	voltageDesc = prometheus.NewDesc(
-		"sensor_lm_voltage_volts",
-		"voltage in volts",
-		[]string{"intype", "chip", "adaptor"},
+	featuresDetectedDesc = prometheus.NewDesc(
+		"sensor_lm_features_detected",
+		"number of features libsensors reports for the chip",
+		[]string{"chip", "device"},
 		nil)
 
-	powerDesc = prometheus.NewDesc(
-		"sensor_lm_power_watts",
-		"power in watts",
-		[]string{"powertype", "chip", "adaptor"},
+	collectCyclesDesc = prometheus.NewDesc(
+		"sensor_lm_collect_cycles_total",
+		"number of times libsensors was read, not counting scrapes served from cache",
+		nil,
 		nil)
 
-	temperatureDesc = prometheus.NewDesc(
-		"sensor_lm_temperature_celsius",
-		"temperature in celsius",
-		[]string{"temptype", "chip", "adaptor"},
+	cachedScrapesDesc = prometheus.NewDesc(
+		"sensor_lm_cached_scrapes_total",
+		"number of scrapes served from the cached reading because the last read was less than -lm.cache-interval ago",
+		nil,
+		nil)
+
+	chipErrorsDesc = prometheus.NewDesc(
+		"sensor_lm_chip_errors_total",
+		"number of times reading a chip failed and the chip was skipped",
+		[]string{"chip"},
+		nil)
+
+	filteredReadingsDesc = prometheus.NewDesc(
+		"sensor_lm_filtered_readings_total",
+		"number of readings dropped for being outside the -filter.* bounds",
+		[]string{"chip", "device"},
+		nil)
+
+	valueAgeDesc = prometheus.NewDesc(
+		"sensor_lm_value_age_seconds",
+		"seconds since the last successful read of libsensors, which the served values may be as old as",
+		nil,
+		nil)
+
+	initSuccessDesc = prometheus.NewDesc(
+		"sensor_lm_init_success",
+		"1 if libsensors was initialized successfully, 0 otherwise",
+		nil,
+		nil)
+
+	initErrorDesc = prometheus.NewDesc(
+		"sensor_lm_init_error_info",
+		"the error libsensors failed to initialize with, present only if it did",
+		[]string{"error"},
+		nil)
+
+	lastCollectDesc = prometheus.NewDesc(
+		"sensor_lm_last_collect_timestamp_seconds",
+		"time the last read of libsensors completed, as seconds since the epoch",
+		nil,
+		nil)
+
+	chipInfoDesc = prometheus.NewDesc(
+		"sensor_lm_chip_info",
+		"bus and address of the chip, always 1",
+		[]string{"chip", "adaptor", "device", "bus_type", "bus_nr", "address"},
 		nil)
 
-	hddTempDesc = prometheus.NewDesc(
-		"sensor_hddsmart_temperature_celsius",
-		"temperature in celsius",
-		[]string{"device", "id"},
+	alarmDesc = prometheus.NewDesc(
+		"sensor_lm_alarm",
+		"1 if the chip raised an alarm or fault for the sub-feature, 0 otherwise",
+		[]string{"chip", "adaptor", "device", "feature"},
 		nil)
+
+	currentDesc = newCurrentDesc("lm")
+
+	fanPwmDesc = prometheus.NewDesc(
+		"sensor_lm_fan_pwm_ratio",
+		"duty cycle the chip drives the fan output with, from 0 to 1",
+		[]string{"chip", "adaptor", "device", "feature"},
+		nil)
+
+	fanMinDesc = newFeatureDesc(
+		"sensor_lm_fan_min_rpm",
+		"minimum fan speed limit in rotations per minute",
+		"fantype", nil)
+
+	humidityDesc = newFeatureDesc(
+		"sensor_lm_humidity_percent",
+		"relative humidity in percent",
+		"humiditytype", nil)
+
+	temperatureDesc = newTemperatureDesc("lm")
+
+	temperatureMaxDesc = newFeatureDesc(
+		"sensor_lm_temperature_max_celsius",
+		"maximum temperature limit in celsius",
+		"temptype", nil)
+
+	temperatureCritDesc = newFeatureDesc(
+		"sensor_lm_temperature_crit_celsius",
+		"critical temperature limit in celsius",
+		"temptype", nil)
+
+	intrusionDesc = newFeatureDesc(
+		"sensor_lm_intrusion",
+		"1 if the chassis intrusion detection latched, 0 otherwise",
+		"intrusiontype", nil)
+
+	intrusionBeepDesc = newFeatureDesc(
+		"sensor_lm_intrusion_beep_enabled",
+		"1 if the chip beeps on chassis intrusion, 0 otherwise",
+		"intrusiontype", nil)
+
+	powerAverageDesc = newFeatureDesc(
+		"sensor_lm_power_average_watts",
+		"average power over the chip's averaging interval in watts",
+		"powertype", nil)
+
+	powerCapDesc = newFeatureDesc(
+		"sensor_lm_power_cap_watts",
+		"power cap in watts",
+		"powertype", nil)
+
+	voltageMinDesc = newFeatureDesc(
+		"sensor_lm_voltage_min_volts",
+		"minimum voltage limit in volts",
+		"intype", nil)
+
+	voltageMaxDesc = newFeatureDesc(
+		"sensor_lm_voltage_max_volts",
+		"maximum voltage limit in volts",
+		"intype", nil)
 )
 
+// newFeatureDesc returns the descriptor of a family with one series per
+// chip feature, told apart by typeLabel, such as "temptype", and the chip,
+// adaptor and device labels.
+func newFeatureDesc(name, help, typeLabel string, constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc(name, help,
+		[]string{typeLabel, "chip", "adaptor", "device"},
+		constLabels)
+}
+
+// The current, fan speed, power, temperature and voltage families are shared
+// with collectors other than lm-sensors, told apart by the source label.
+// Their help text must not depend on the source, since the registry rejects
+// a family whose series disagree on it.
+
+func newCurrentDesc(source string) *prometheus.Desc {
+	return newFeatureDesc(
+		"sensor_lm_current_amperes",
+		"current in amperes, as last read by the collector named in the source label",
+		"currtype", prometheus.Labels{"source": source})
+}
+
+func newFanspeedDesc(source string) *prometheus.Desc {
+	return newFeatureDesc(
+		"sensor_lm_fan_speed_rpm",
+		"fan speed in rotations per minute, as last read by the collector named in the source label",
+		"fantype", prometheus.Labels{"source": source})
+}
+
+func newPowerDesc(source string) *prometheus.Desc {
+	return newFeatureDesc(
+		"sensor_lm_power_watts",
+		"power in watts, as last read by the collector named in the source label",
+		"powertype", prometheus.Labels{"source": source})
+}
+
+func newTemperatureDesc(source string) *prometheus.Desc {
+	return newFeatureDesc(
+		"sensor_lm_temperature_celsius",
+		"temperature in celsius, as last read by the collector named in the source label",
+		"temptype", prometheus.Labels{"source": source})
+}
+
+func newVoltageDesc(source string) *prometheus.Desc {
+	return newFeatureDesc(
+		"sensor_lm_voltage_volts",
+		"voltage in volts, as last read by the collector named in the source label",
+		"intype", prometheus.Labels{"source": source})
+}
+
+// shutdownTimeout bounds how long in-flight scrapes may take to finish on exit.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	var (
-		listenAddress  = flag.String("web.listen-address", ":9255", "Address on which to expose metrics and web interface.")
-		metricsPath    = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
-		hddtempAddress = flag.String("hddtemp-address", "localhost:7634", "Address to fetch hdd metrics from.")
+		showVersion     = flag.Bool("version", false, "Print version information and exit.")
+		configFile      = flag.String("config.file", "", "Path to a YAML configuration file.")
+		dump            = flag.Bool("dump", false, "Collect once from every enabled collector, print the metrics to stdout and exit.")
+		logLevel        = flag.String("log.level", "info", "Only log messages with the given severity or above: debug, info, warn or error.")
+		logFormat       = flag.String("log.format", "logfmt", "Output format of log messages: logfmt or json.")
+		listenAddress   = flag.String("web.listen-address", ":9255", "Address on which to expose metrics and web interface.")
+		metricsPath     = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
+		metricsAliases  = flag.String("web.telemetry-alias", "", "Comma-separated list of additional paths under which to expose metrics.")
+		upstreamURL     = flag.String("web.upstream-url", "", "URL of another exporter's metrics, such as http://localhost:9100/metrics, to merge into ours.")
+		upstreamTimeout = flag.Duration("web.upstream-timeout", 5*time.Second, "Timeout for fetching the -web.upstream-url metrics.")
+		readTimeout     = flag.Duration("web.read-timeout", 10*time.Second, "Maximum time to read a request, headers and body. 0 disables the timeout.")
+		writeTimeout    = flag.Duration("web.write-timeout", time.Minute, "Maximum time from the end of a request's headers to the end of its response; must exceed the slowest scrape. 0 disables the timeout.")
+		idleTimeout     = flag.Duration("web.idle-timeout", time.Minute, "Maximum time to keep an idle keep-alive connection open. 0 uses -web.read-timeout.")
+		webConfigFile   = flag.String("web.config.file", "", "Path to a web configuration file enabling TLS or basic authentication.")
+		disableExporter = flag.Bool("web.disable-exporter-metrics", false, "Don't serve the go_*, process_* and promhttp_* metrics about the exporter process itself.")
+		enablePprof     = flag.Bool("web.enable-pprof", false, "Serve the Go profiling endpoints under /debug/pprof/.")
+		enableRefresh   = flag.Bool("web.enable-refresh", false, "Serve /-/refresh, which runs every collector once on POST, bypassing the lm-sensors cache.")
+		enableJSON      = flag.Bool("web.enable-json", false, "Serve the current sensor readings as JSON under /sensors.json.")
+		landingPageFile = flag.String("web.landing-page", "", "Path to an HTML template replacing the landing page.")
+		hddtempAddress  = flag.String("hddtemp-address", "localhost:7634", "Comma-separated list of addresses (host:port or unix:/path) to fetch hdd metrics from.")
+		hddtempTimeout  = flag.Duration("hddtemp-timeout", 2*time.Second, "Timeout for connecting to and reading from hddtemp.")
+		hddtempResolve  = flag.Duration("hddtemp-resolve-interval", 5*time.Minute, "How long to reuse the resolved IP of a hddtemp host name before looking it up again. It is also looked up again after a failed connection. 0 looks it up on every connection.")
+		hddtempStream   = flag.Bool("hddtemp-stream", false, "Keep the connection to hddtemp open and read the latest of the readings it streams, one per line, instead of connecting for every scrape.")
+		hddtempMaxAge   = flag.Duration("hddtemp-stream-max-age", time.Minute, "With -hddtemp-stream, reconnect to hddtemp when it streamed no reading for this long.")
+		lmChipInclude   = flag.String("lm.chip-include", "", "Regexp of lm-sensors chips to export; overrides -lm.chip-exclude.")
+		lmChipExclude   = flag.String("lm.chip-exclude", "", "Regexp of lm-sensors chips not to export.")
+		lmFeatExclude   = flag.String("lm.feature-exclude", "", "Regexp of lm-sensors feature names, such as in7 or temp5, not to export from the chips exported.")
+		lmCacheInterval = flag.Duration("lm.cache-interval", time.Second, "Minimum time between two reads of lm-sensors; scrapes in between are served the previous reading. Short intervals increase CGO and sensor bus overhead.")
+		collectTimeout  = flag.Duration("collector.timeout", 0, "Maximum time a collector may take per scrape; its remaining metrics are dropped and its scrape reported as failed. 0 disables the timeout.")
+		lmSampleIntvl   = flag.Duration("lm.sample-interval", 0, "Interval at which to sample lm-sensors temperatures between scrapes, exported as sensor_lm_temperature_celsius_distribution. 0 disables sampling.")
+		lmWatchdog      = flag.Duration("lm.watchdog-timeout", 0, "Exit, to be restarted by the service manager, if an lm-sensors read takes longer than this, as when stuck in libsensors. 0 disables the watchdog.")
+		lmSampleIdle    = flag.Duration("lm.sample-idle-after", 5*time.Minute, "Pause -lm.sample-interval sampling while lm-sensors hasn't been scraped for this long. 0 samples even when not scraped.")
+		exemplarThresh  = flag.Float64("lm.exemplar-threshold", math.Inf(1), "Temperature in celsius at which -lm.sample-interval samples log a warning and count a crossing in sensor_lm_temperature_threshold_crossings_total, with the event_id of the warning as exemplar.")
+		sysfsPath       = flag.String("path.sysfs", "/sys", "Mount point of the sysfs filesystem.")
+		sshHosts        = flag.String("sysfs.ssh-hosts", "", "Comma-separated list of remote hosts, as host or user@host, whose sysfs the sysfs collectors also read over SSH, with a host label.")
+		sshPath         = flag.String("sysfs.ssh-path", "ssh", "Path to the ssh binary run to read -sysfs.ssh-hosts.")
+		sshTimeout      = flag.Duration("sysfs.ssh-timeout", 10*time.Second, "Timeout for reading the sysfs of a -sysfs.ssh-hosts host.")
+		metricNamespace = flag.String("metric.namespace", "sensor", "Namespace replacing the sensor_ prefix of metric names.")
+		metricSubsystem = flag.String("metric.subsystem", "lm", "Subsystem replacing the lm_ part of lm-sensors metric names.")
+		tempUnit        = flag.String("temperature.unit", "celsius", "Also serve every *_celsius gauge converted to this unit and renamed after it, such as *_fahrenheit: celsius (nothing more), fahrenheit or kelvin.")
+		maxSeries       = flag.Int("metric.max-series", 0, "Maximum number of distinct series to serve from the collectors; new series beyond it are dropped and counted in sensor_dropped_series_total. 0 means no limit.")
+		sanitizeLabels  = flag.Bool("metric.sanitize-labels", false, "Lowercase lm-sensors chip, adaptor and feature label values and replace other characters than letters and digits with underscores.")
+		smartctlPath    = flag.String("nvme.smartctl-path", "smartctl", "Path to the smartctl binary.")
+		nvmeDevices     = flag.String("nvme.devices", "", "Comma-separated list of NVMe devices to read; discovered from sysfs if empty.")
+		nutAddress      = flag.String("nut.address", "localhost:3493", "Address of the Network UPS Tools daemon (upsd).")
+		nutUps          = flag.String("nut.ups", "", "Comma-separated list of UPS names to read; all UPSes served by upsd if empty.")
+		nutUsername     = flag.String("nut.username", "", "Username to log in to upsd with.")
+		nutPassword     = flag.String("nut.password", "", "Password to log in to upsd with.")
+		nutTimeout      = flag.Duration("nut.timeout", 2*time.Second, "Timeout for talking to upsd.")
+		collectdSocket  = flag.String("collectd.socket", "/var/run/collectd-unixsock", "Path of the socket of collectd's unixsock plugin.")
+		collectdHost    = flag.String("collectd.host", "", "Host name, as collectd names it, of the sensors plugin values to read; every host collectd has values for if empty.")
+		collectdTimeout = flag.Duration("collectd.timeout", 2*time.Second, "Timeout for talking to collectd.")
+		nvidiaSmiPath   = flag.String("gpu.nvidia-smi-path", "nvidia-smi", "Path to the nvidia-smi binary.")
+		ipmitoolPath    = flag.String("ipmi.ipmitool-path", "ipmitool", "Path to the ipmitool binary.")
+		sensorsPath     = flag.String("lm-json.sensors-path", "sensors", "Path to the lm-sensors sensors binary run by the lm_json collector.")
+		vcgencmdPath    = flag.String("rpi.vcgencmd-path", "vcgencmd", "Path to the Raspberry Pi vcgencmd binary.")
 	)
+	collectorFlags := make(map[string]*bool)
+	for _, name := range collectorNames() {
+		collectorFlags[name] = flag.Bool("collector."+name, knownCollectors[name], fmt.Sprintf("Enable the %s collector.", name))
+	}
+	extraLabels := make(labelsFlag)
+	flag.Var(extraLabels, "label", "Constant label added to every metric, as name=value. Repeatable.")
+	filterMinFlags := make(map[string]*float64)
+	filterMaxFlags := make(map[string]*float64)
+	for name, f := range readingFilters {
+		filterMinFlags[name] = flag.Float64("filter."+name+"-min", math.Inf(-1), fmt.Sprintf("Drop lm-sensors %s readings below this value, in %s.", name, f.unit))
+		filterMaxFlags[name] = flag.Float64("filter."+name+"-max", math.Inf(1), fmt.Sprintf("Drop lm-sensors %s readings above this value, in %s.", name, f.unit))
+	}
 	flag.Parse()
 
-	hddcollector := NewHddCollector(*hddtempAddress)
-	if err := hddcollector.Init(); err != nil {
-		log.Printf("error readding hddtemps: %v", err)
+	if *showVersion {
+		fmt.Println(version.Print("sensor-exporter"))
+		os.Exit(0)
 	}
-	prometheus.MustRegister(hddcollector)
 
-	lmscollector := NewLmSensorsCollector()
-	lmscollector.Init()
-	prometheus.MustRegister(lmscollector)
+	logger, err := newLogger(*logLevel, *logFormat)
+	if err != nil {
+		fatal("error setting up logging", "err", err)
+	}
+	slog.SetDefault(logger)
 
-	http.Handle(*metricsPath, prometheus.Handler())
+	var (
+		calibration map[string]map[string]Calibration
+		pools       map[string][]string
+		metadata    map[string]MetricMetadata
+	)
+	if *configFile != "" {
+		config, err := LoadConfig(*configFile)
+		if err != nil {
+			fatal("error loading config file", "err", err)
+		}
+		if err := config.ApplyFlags(); err != nil {
+			fatal("error loading config file", "err", err)
+		}
+		calibration = config.LM.Calibration
+		pools = config.Pools
+		metadata = config.Metrics
+	}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-			<head><title>Sensor Exporter</title></head>
-			<body>
-			<h1>Sensor Exporter</h1>
-			<p><a href="` + *metricsPath + `">Metrics</a></p>
-			</body>
-			</html>`))
+	if err := validateMetricPrefix(*metricNamespace, *metricSubsystem); err != nil {
+		fatal("invalid metric namespace or subsystem", "err", err)
+	}
+	if *collectTimeout < 0 {
+		fatal("invalid -collector.timeout: must not be negative", "value", *collectTimeout)
+	}
+	if *hddtempTimeout <= 0 {
+		fatal("invalid -hddtemp-timeout: must be positive", "value", *hddtempTimeout)
+	}
+	if *hddtempResolve < 0 {
+		fatal("invalid -hddtemp-resolve-interval: must not be negative", "value", *hddtempResolve)
+	}
+	if *hddtempMaxAge <= 0 {
+		fatal("invalid -hddtemp-stream-max-age: must be positive", "value", *hddtempMaxAge)
+	}
+	aliases := splitList(*metricsAliases)
+	for i, alias := range aliases {
+		if !strings.HasPrefix(alias, "/") || alias == "/" || alias == *metricsPath || slices.Contains(aliases[:i], alias) {
+			fatal("invalid -web.telemetry-alias: paths must start with '/' and differ from / and each other", "path", alias)
+		}
+	}
+	if _, ok := temperatureUnits[*tempUnit]; !ok {
+		fatal("invalid -temperature.unit: must be celsius, fahrenheit or kelvin", "unit", *tempUnit)
+	}
+	if *maxSeries < 0 {
+		fatal("invalid -metric.max-series: must not be negative", "value", *maxSeries)
+	}
+	if *readTimeout < 0 || *writeTimeout < 0 || *idleTimeout < 0 {
+		fatal("invalid -web.read-timeout, -web.write-timeout or -web.idle-timeout: must not be negative",
+			"read", *readTimeout, "write", *writeTimeout, "idle", *idleTimeout)
+	}
+	if *upstreamTimeout < 0 {
+		fatal("invalid -web.upstream-timeout: must not be negative", "value", *upstreamTimeout)
+	}
+	if *upstreamURL != "" {
+		if u, err := url.Parse(*upstreamURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			fatal("invalid -web.upstream-url: must be an http or https URL", "url", *upstreamURL)
+		}
+	}
+	if *nutTimeout <= 0 {
+		fatal("invalid -nut.timeout: must be positive", "value", *nutTimeout)
+	}
+	if *collectdTimeout <= 0 {
+		fatal("invalid -collectd.timeout: must be positive", "value", *collectdTimeout)
+	}
+	if *lmWatchdog < 0 {
+		fatal("invalid -lm.watchdog-timeout: must not be negative", "value", *lmWatchdog)
+	}
+	if *lmSampleIdle < 0 {
+		fatal("invalid -lm.sample-idle-after: must not be negative", "value", *lmSampleIdle)
+	}
+	if *lmSampleIntvl < 0 {
+		fatal("invalid -lm.sample-interval: must not be negative", "value", *lmSampleIntvl)
+	}
+	if *lmCacheInterval < 0 {
+		fatal("invalid -lm.cache-interval: must not be negative", "value", *lmCacheInterval)
+	}
+	remoteHosts := splitList(*sshHosts)
+	for i, host := range remoteHosts {
+		if strings.HasPrefix(host, "-") || slices.Contains(remoteHosts[:i], host) {
+			fatal("invalid -sysfs.ssh-hosts: hosts must not start with '-' or be listed twice", "host", host)
+		}
+	}
+	if _, ok := extraLabels["host"]; ok && len(remoteHosts) > 0 {
+		fatal("invalid -label host: the host label is set by -sysfs.ssh-hosts")
+	}
+	if *sshTimeout < 0 {
+		fatal("invalid -sysfs.ssh-timeout: must not be negative", "value", *sshTimeout)
+	}
+	bounds := make(map[string]readingBounds)
+	for name, f := range readingFilters {
+		b := readingBounds{min: *filterMinFlags[name], max: *filterMaxFlags[name]}
+		if b.min > b.max {
+			fatal("invalid -filter."+name+"-min: above -filter."+name+"-max", "min", b.min, "max", b.max)
+		}
+		if !b.unbounded() {
+			bounds[f.subsystem] = b
+		}
+	}
+	chipInclude, err := compileOptionalRegexp(*lmChipInclude)
+	if err != nil {
+		fatal("invalid -lm.chip-include", "err", err)
+	}
+	chipExclude, err := compileOptionalRegexp(*lmChipExclude)
+	if err != nil {
+		fatal("invalid -lm.chip-exclude", "err", err)
+	}
+	featureExclude, err := compileOptionalRegexp(*lmFeatExclude)
+	if err != nil {
+		fatal("invalid -lm.feature-exclude", "err", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	baseRegisterer := prometheus.WrapRegistererWith(prometheus.Labels(extraLabels), registry)
+	registerer := baseRegisterer
+	if len(remoteHosts) > 0 {
+		// The series of remote hosts have a host label, so those of this
+		// one need one too, empty so that they stay the same series.
+		registerer = prometheus.WrapRegistererWith(prometheus.Labels{"host": ""}, baseRegisterer)
+	}
+	registerWith := func(r prometheus.Registerer, cs ...prometheus.Collector) {
+		for _, c := range cs {
+			if err := r.Register(c); err != nil {
+				fatal("error registering collector", "err", err)
+			}
+		}
+	}
+	mustRegister := func(cs ...prometheus.Collector) {
+		registerWith(registerer, cs...)
+	}
+	mustRegister(versioncollector.NewCollector("sensor_exporter"))
+	if !*disableExporter {
+		mustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+
+	register := func(c prometheus.Collector, status scrapeStatus) {
+		mustRegister(withTimeout(c, status, *collectTimeout))
+	}
+
+	if *collectorFlags["hddtemp"] {
+		var streamMaxAge time.Duration
+		if *hddtempStream {
+			streamMaxAge = *hddtempMaxAge
+		}
+		for _, address := range splitList(*hddtempAddress) {
+			hddcollector := NewHddCollector(address, *hddtempTimeout, *hddtempResolve, streamMaxAge)
+			if err := hddcollector.Init(); err != nil {
+				slog.Warn("hddtemp not reachable yet, will retry when scraped", "address", address, "err", err)
+			}
+			register(hddcollector, hddcollector.status)
+		}
+	}
+
+	var lmscollector *LmSensorsCollector
+	if *collectorFlags["lm"] {
+		if !lmSupported {
+			fatal("the lm collector is only supported on Linux")
+		}
+		lmscollector = NewLmSensorsCollector(chipInclude, chipExclude, featureExclude, *lmCacheInterval, *sanitizeLabels, bounds, calibration)
+		if err := lmscollector.Init(); err != nil {
+			slog.Error("lm-sensors not available, the other collectors keep running", "err", err)
+		}
+		if *lmWatchdog > 0 {
+			lmscollector.StartWatchdog(*lmWatchdog)
+		}
+		if *lmSampleIntvl > 0 {
+			lmscollector.StartSampling(*lmSampleIntvl, *lmSampleIdle, *exemplarThresh)
+		}
+		register(lmscollector, lmscollector.status)
+	}
+
+	// The sysfs collectors read this host's sysfs and that of every
+	// -sysfs.ssh-hosts host.
+	registerSysfs := func(r prometheus.Registerer, sysfs sysfsTree) {
+		register := func(c prometheus.Collector, status scrapeStatus) {
+			registerWith(r, withTimeout(c, status, *collectTimeout))
+		}
+		if *collectorFlags["thermal_zone"] {
+			c := NewThermalZoneCollector(sysfs)
+			register(c, c.status)
+		}
+		if *collectorFlags["rapl"] {
+			c := NewRaplCollector(sysfs)
+			register(c, c.status)
+		}
+		if *collectorFlags["cooling_device"] {
+			c := NewCoolingDeviceCollector(sysfs)
+			register(c, c.status)
+		}
+		if *collectorFlags["drivetemp"] {
+			c := NewDrivetempCollector(sysfs)
+			register(c, c.status)
+		}
+		if *collectorFlags["power_supply"] {
+			c := NewPowerSupplyCollector(sysfs)
+			register(c, c.status)
+		}
+		if *collectorFlags["hwmon"] {
+			c := NewHwmonCollector(sysfs)
+			register(c, c.status)
+		}
+	}
+	registerSysfs(registerer, newLocalSysfs(*sysfsPath))
+	for _, host := range remoteHosts {
+		registerSysfs(prometheus.WrapRegistererWith(prometheus.Labels{"host": host}, baseRegisterer),
+			newSSHSysfs(host, *sshPath, *sshTimeout))
+	}
+
+	if *collectorFlags["smc"] {
+		if !smcSupported {
+			fatal("the smc collector is only supported on macOS, in builds with cgo")
+		}
+		c := NewSMCCollector()
+		register(c, c.status)
+	}
+
+	if *collectorFlags["wmi"] {
+		if !wmiSupported {
+			fatal("the wmi collector is only supported on Windows")
+		}
+		c := NewWmiCollector()
+		register(c, c.status)
+	}
+
+	if *collectorFlags["nvme"] {
+		c := NewNvmeCollector(*smartctlPath, splitList(*nvmeDevices), *sysfsPath, *collectTimeout)
+		register(c, c.status)
+	}
+
+	if *collectorFlags["nut"] {
+		c := NewNutCollector(*nutAddress, splitList(*nutUps), *nutUsername, *nutPassword, *nutTimeout)
+		register(c, c.status)
+	}
+
+	if *collectorFlags["collectd"] {
+		if _, err := os.Stat(*collectdSocket); err != nil {
+			slog.Warn("collectd socket not found, the collectd collector will fail until collectd is running", "socket", *collectdSocket, "err", err)
+		}
+		c := NewCollectdCollector(*collectdSocket, *collectdHost, *collectdTimeout)
+		register(c, c.status)
+	}
+
+	if *collectorFlags["gpu"] {
+		c := NewGpuCollector(*nvidiaSmiPath, *collectTimeout)
+		register(c, c.status)
+	}
+
+	if *collectorFlags["ipmi"] {
+		c := NewIpmiCollector(*ipmitoolPath, *collectTimeout)
+		register(c, c.status)
+	}
+
+	if *collectorFlags["lm_json"] {
+		c := NewLmJSONCollector(*sensorsPath, chipInclude, chipExclude, featureExclude, *collectTimeout)
+		register(c, c.status)
+	}
+	if *collectorFlags["rpi"] {
+		if _, err := exec.LookPath(*vcgencmdPath); err != nil {
+			slog.Warn("vcgencmd not found, the rpi collector will fail until it is installed", "path", *vcgencmdPath, "err", err)
+		}
+		c := NewRpiCollector(*vcgencmdPath, *collectTimeout)
+		register(c, c.status)
+	}
+
+	// The exporter status is gathered after all other collectors have run.
+	statusRegistry := prometheus.NewRegistry()
+	statusRegisterer := prometheus.WrapRegistererWith(prometheus.Labels(extraLabels), statusRegistry)
+	statusRegisterer.MustRegister(NewExporterStatusCollector(), scrapeDurations)
+	var collected prometheus.Gatherer = registry
+	if len(pools) > 0 {
+		collected = newPoolGatherer(collected, pools, prometheus.Labels(extraLabels))
+	}
+	if *maxSeries > 0 {
+		limited, dropped := newSeriesLimitGatherer(collected, *maxSeries)
+		statusRegisterer.MustRegister(dropped)
+		collected = limited
+	}
+	collected = newUnitGatherer(collected, *tempUnit)
+	gatherer := newRenamingGatherer(prometheus.Gatherers{collected, statusRegistry}, *metricNamespace, *metricSubsystem)
+	gatherer = newMetadataGatherer(gatherer, metadata)
+
+	if *dump {
+		err := dumpMetrics(os.Stdout, gatherer)
+		if lmscollector != nil {
+			lmscollector.Cleanup()
+		}
+		if err != nil {
+			fatal("error dumping metrics", "err", err)
+		}
+		return
+	}
+
+	// The upstream metrics are merged outside of the renaming, which only
+	// applies to ours.
+	served := gatherer
+	if *upstreamURL != "" {
+		federating, up := newFederatingGatherer(gatherer, *upstreamURL, *upstreamTimeout)
+		statusRegisterer.MustRegister(up)
+		served = federating
+	}
+
+	mux := http.NewServeMux()
+	metricsHandler := promhttp.HandlerFor(served, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
 	})
-	http.ListenAndServe(*listenAddress, nil)
+	if !*disableExporter {
+		metricsHandler = promhttp.InstrumentMetricHandler(baseRegisterer, metricsHandler)
+	}
+	mux.Handle(*metricsPath, metricsHandler)
+	for _, alias := range aliases {
+		mux.Handle(alias, metricsHandler)
+	}
+
+	mux.HandleFunc("/-/healthy", healthyHandler)
+	mux.HandleFunc("/-/ready", readyHandler)
+	if *enablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	if *enableJSON {
+		mux.Handle("/sensors.json", jsonHandler(registry))
+	}
+	if *enableRefresh {
+		mux.Handle("/-/refresh", refreshHandler(registry, lmscollector))
+	}
+
+	enabledCollectors := make(map[string]bool)
+	for name, enabled := range collectorFlags {
+		enabledCollectors[name] = *enabled
+	}
+	landing, err := newLandingPage(*landingPageFile, *metricsPath, enabledCollectors, *enablePprof, *enableJSON)
+	if err != nil {
+		fatal("error loading landing page", "file", *landingPageFile, "err", err)
+	}
+	mux.Handle("/", landing)
+
+	// Timeouts keep slow or stalled clients from holding connections, and
+	// their goroutines, forever.
+	server := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+	}
+	webFlags := &web.FlagConfig{
+		WebListenAddresses: &[]string{*listenAddress},
+		WebConfigFile:      webConfigFile,
+	}
+	go func() {
+		if err := web.ListenAndServe(server, webFlags, slog.Default()); err != http.ErrServerClosed {
+			fatal("error serving HTTP", "err", err)
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	slog.Info("shutting down", "signal", (<-sigs).String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("error shutting down HTTP server", "err", err)
+	}
+	if lmscollector != nil {
+		lmscollector.Cleanup()
+	}
+}
+
+// newLogger returns a logger writing messages of the given level or above to
+// stderr in format, which is "logfmt" or "json".
+func newLogger(level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid -log.level: %v", err)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "logfmt":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid -log.format: %s", format)
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// dumpMetrics gathers once from g and writes the result to w in the
+// Prometheus text format.  Metrics that were gathered are written even if
+// some collector failed.
+func dumpMetrics(w io.Writer, g prometheus.Gatherer) error {
+	families, gatherErr := g.Gather()
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return gatherErr
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// compileOptionalRegexp compiles expr, returning nil for an empty expression.
+func compileOptionalRegexp(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
 }
 
 type (
-	LmSensorsCollector struct{}
+	LmSensorsCollector struct {
+		chipInclude   *regexp.Regexp
+		chipExclude   *regexp.Regexp
+		featExclude   *regexp.Regexp
+		cacheInterval time.Duration
+		sanitize      bool
+		bounds        map[string]readingBounds
+		calibration   map[string]map[string]Calibration
+		status        scrapeStatus
+
+		// mu serializes reads, since libsensors is not safe for concurrent
+		// use, and guards the cached result of the last one.
+		mu       sync.Mutex
+		cache    []prometheus.Metric
+		cachedAt time.Time
+		cycles   int
+		cached   int
+		// filtered counts the readings dropped by bounds, by chip and
+		// device.
+		filtered map[[2]string]int
+		// chipErrors counts the reads of a chip that panicked, by chip.
+		chipErrors map[string]int
+		// succeededAt is the time of the last read that succeeded.
+		succeededAt time.Time
+		// readingSince is the time, in Unix nanoseconds, the libsensors
+		// read in progress started, 0 if none is.  It is read by the
+		// watchdog without l.mu, which the read holds.
+		readingSince atomic.Int64
+		// exit is called by the watchdog to exit the process, os.Exit
+		// but in tests.
+		exit func(code int)
+		// initErr is the error Init failed with, if any.  libsensors is
+		// not read then.
+		initErr error
+
+		// samples holds the temperatures sampled since the last scrape
+		// if StartSampling was called.
+		samples      map[string]*temperatureSamples
+		stopSampling chan struct{}
+		samplingDone chan struct{}
+		// scrapedAt is the time of the last scrape, cached or not.
+		scrapedAt time.Time
+		// threshold is the temperature whose crossings are counted,
+		// keyed like samples, if it is finite.
+		threshold float64
+		crossings map[string]*thresholdCrossings
+	}
 )
 
-func NewLmSensorsCollector() *LmSensorsCollector {
-	return &LmSensorsCollector{}
+// NewLmSensorsCollector returns a collector for the chips whose name matches
+// chipInclude, or if that is nil, doesn't match chipExclude, leaving out the
+// features whose name, such as "in7", matches featureExclude.  Any of them
+// may be nil.
+// Readings are served from cache to scrapes less than cacheInterval apart.
+// If sanitize is set, chip, adaptor and feature label values are passed
+// through sanitizeLabelValue.  Readings outside the bounds of their
+// lmSubsystems key are dropped, after correcting them by calibration, keyed by
+// chip and feature name.
+func NewLmSensorsCollector(chipInclude, chipExclude, featureExclude *regexp.Regexp, cacheInterval time.Duration, sanitize bool, bounds map[string]readingBounds, calibration map[string]map[string]Calibration) *LmSensorsCollector {
+	return &LmSensorsCollector{
+		chipInclude:   chipInclude,
+		chipExclude:   chipExclude,
+		featExclude:   featureExclude,
+		cacheInterval: cacheInterval,
+		sanitize:      sanitize,
+		bounds:        bounds,
+		calibration:   calibration,
+		filtered:      make(map[[2]string]int),
+		chipErrors:    make(map[string]int),
+		status:        newScrapeStatus("lm", ""),
+		exit:          os.Exit,
+	}
+}
+
+// lmSubsystems maps libsensors feature name prefixes to the metric they are
+// exported as.  Features matching none of the prefixes are ignored.
+var lmSubsystems = map[string]struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+}{
+	"curr":      {currentDesc, prometheus.GaugeValue},
+	"energy":    {energyDesc, prometheus.CounterValue},
+	"fan":       {fanspeedDesc, prometheus.GaugeValue},
+	"humidity":  {humidityDesc, prometheus.GaugeValue},
+	"in":        {voltageDesc, prometheus.GaugeValue},
+	"intrusion": {intrusionDesc, prometheus.GaugeValue},
+	"power":     {powerDesc, prometheus.GaugeValue},
+	"temp":      {temperatureDesc, prometheus.GaugeValue},
 }
 
-func (l *LmSensorsCollector) Init() {
-	gosensors.Init()
+// lmLimits maps lmSubsystems keys to the limit sub-features, and other
+// settings such as intrusion beeps, exported alongside the reading with the
+// same labels.  Sub-features a chip doesn't report are skipped.
+var lmLimits = map[string]map[string]*prometheus.Desc{
+	"fan":       {"min": fanMinDesc},
+	"in":        {"min": voltageMinDesc, "max": voltageMaxDesc},
+	"intrusion": {"beep": intrusionBeepDesc},
+	"power":     {"average": powerAverageDesc, "cap": powerCapDesc},
+	"temp":      {"max": temperatureMaxDesc, "crit": temperatureCritDesc},
+}
+
+// classifyFeature returns the lmSubsystems key matching a feature name such
+// as "temp1".  The key must be followed by the feature number, so that "in"
+// matches "in0" but not "intrusion0" or "info".
+func classifyFeature(name string) (subsystem string, ok bool) {
+	subsystem = strings.TrimRight(name, "0123456789")
+	if subsystem == name {
+		return "", false
+	}
+	_, ok = lmSubsystems[subsystem]
+	return subsystem, ok
+}
+
+func isAlarmSubFeature(key string) bool {
+	return key == "alarm" || key == "fault" || strings.HasSuffix(key, "_alarm")
 }
 
 // Describe implements prometheus.Collector.
 func (l *LmSensorsCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- fanspeedDesc
-	ch <- powerDesc
-	ch <- temperatureDesc
-	ch <- voltageDesc
+	for _, s := range lmSubsystems {
+		ch <- s.desc
+	}
+	for _, limits := range lmLimits {
+		for _, desc := range limits {
+			ch <- desc
+		}
+	}
+	ch <- alarmDesc
+	ch <- fanPwmDesc
+	ch <- chipsDetectedDesc
+	ch <- featuresDetectedDesc
+	ch <- chipInfoDesc
+	ch <- collectCyclesDesc
+	ch <- cachedScrapesDesc
+	ch <- valueAgeDesc
+	ch <- filteredReadingsDesc
+	ch <- chipErrorsDesc
+	ch <- temperatureDistributionDesc
+	ch <- thresholdCrossingsDesc
+	ch <- lastCollectDesc
+	ch <- initSuccessDesc
+	ch <- initErrorDesc
+	l.status.describe(ch)
+}
+
+// Invalidate drops the cached reading, so that the next scrape reads
+// libsensors whatever -lm.cache-interval.
+func (l *LmSensorsCollector) Invalidate() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache = nil
 }
 
 // Collect implements prometheus.Collector.
 func (l *LmSensorsCollector) Collect(ch chan<- prometheus.Metric) {
-	for _, chip := range gosensors.GetDetectedChips() {
-		chipName := chip.String()
-		adaptorName := chip.AdapterName()
-		for _, feature := range chip.GetFeatures() {
-			if strings.HasPrefix(feature.Name, "fan") {
-				ch <- prometheus.MustNewConstMetric(fanspeedDesc,
-					prometheus.GaugeValue,
-					feature.GetValue(),
-					feature.GetLabel(), chipName, adaptorName)
-			} else if strings.HasPrefix(feature.Name, "temp") {
-				ch <- prometheus.MustNewConstMetric(temperatureDesc,
-					prometheus.GaugeValue,
-					feature.GetValue(),
-					feature.GetLabel(), chipName, adaptorName)
-			} else if strings.HasPrefix(feature.Name, "in") {
-				ch <- prometheus.MustNewConstMetric(voltageDesc,
-					prometheus.GaugeValue,
-					feature.GetValue(),
-					feature.GetLabel(), chipName, adaptorName)
-			} else if strings.HasPrefix(feature.Name, "power") {
-				ch <- prometheus.MustNewConstMetric(powerDesc,
-					prometheus.GaugeValue,
-					feature.GetValue(),
-					feature.GetLabel(), chipName, adaptorName)
-			}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.scrapedAt = time.Now()
+	if l.cache == nil || time.Since(l.cachedAt) >= l.cacheInterval {
+		var err error
+		l.cache, err = l.read()
+		l.cachedAt = time.Now()
+		l.cycles++
+		if err == nil {
+			l.succeededAt = l.cachedAt
 		}
+	} else {
+		l.cached++
+	}
+	for _, m := range l.cache {
+		ch <- m
+	}
+	ch <- prometheus.MustNewConstMetric(collectCyclesDesc, prometheus.CounterValue, float64(l.cycles))
+	ch <- prometheus.MustNewConstMetric(cachedScrapesDesc, prometheus.CounterValue, float64(l.cached))
+	ch <- prometheus.MustNewConstMetric(lastCollectDesc,
+		prometheus.GaugeValue,
+		float64(l.cachedAt.UnixNano())/1e9)
+	l.collectSamples(ch)
+	for key, n := range l.filtered {
+		ch <- prometheus.MustNewConstMetric(filteredReadingsDesc, prometheus.CounterValue, float64(n), key[0], key[1])
+	}
+	for chip, n := range l.chipErrors {
+		ch <- prometheus.MustNewConstMetric(chipErrorsDesc, prometheus.CounterValue, float64(n), chip)
+	}
+	if !l.succeededAt.IsZero() {
+		ch <- prometheus.MustNewConstMetric(valueAgeDesc,
+			prometheus.GaugeValue,
+			time.Since(l.succeededAt).Seconds())
+	}
+	if l.initErr != nil {
+		ch <- prometheus.MustNewConstMetric(initSuccessDesc, prometheus.GaugeValue, 0)
+		ch <- prometheus.MustNewConstMetric(initErrorDesc, prometheus.GaugeValue, 1, l.initErr.Error())
+	} else {
+		ch <- prometheus.MustNewConstMetric(initSuccessDesc, prometheus.GaugeValue, 1)
 	}
 }
 
+// read collects from libsensors once, returning the metrics, scrape status
+// included, and the error if the read failed.
+func (l *LmSensorsCollector) read() ([]prometheus.Metric, error) {
+	var metrics []prometheus.Metric
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+
+	begin := time.Now()
+	err := l.initErr
+	if err == nil {
+		err = l.watchedCollect(ch)
+	}
+	if err != nil {
+		slog.Error("error reading lm-sensors", "err", err)
+	}
+	l.status.collect(ch, begin, err)
+	close(ch)
+	<-done
+	return metrics, err
+}
+
+// busTypeNames maps the libsensors SENSORS_BUS_TYPE_* constants to names.
+var busTypeNames = map[int16]string{
+	-1: "any",
+	0:  "i2c",
+	1:  "isa",
+	2:  "pci",
+	3:  "spi",
+	4:  "virtual",
+	5:  "acpi",
+	6:  "hid",
+	7:  "mdio",
+	8:  "scsi",
+}
+
+func busTypeName(t int16) string {
+	if name, ok := busTypeNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+// sanitizeLabelValue lowercases s and replaces everything but ASCII letters
+// and digits with underscores, e.g. "ISA adapter" becomes "isa_adapter".
+func sanitizeLabelValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, s)
+}
+
+func (l *LmSensorsCollector) label(s string) string {
+	if l.sanitize {
+		return sanitizeLabelValue(s)
+	}
+	return s
+}
+
+// readingFilters maps the names of the -filter.<name>-min/max flags to the
+// lmSubsystems key they bound.
+var readingFilters = map[string]struct {
+	subsystem string
+	unit      string
+}{
+	"current": {"curr", "amperes"},
+	"fan":     {"fan", "RPM"},
+	"power":   {"power", "watts"},
+	"temp":    {"temp", "celsius"},
+	"voltage": {"in", "volts"},
+}
+
+// readingBounds is the range of plausible readings of a kind of sensor.
+type readingBounds struct {
+	min, max float64
+}
+
+func (b readingBounds) unbounded() bool {
+	return math.IsInf(b.min, -1) && math.IsInf(b.max, 1)
+}
+
+func (b readingBounds) contains(value float64) bool {
+	return value >= b.min && value <= b.max
+}
+
+// calibrate corrects a reading of a feature of the named chip, both by their
+// libsensors names, by its calibration if it has one.
+func (l *LmSensorsCollector) calibrate(chip, feature string, value float64) float64 {
+	if cal, ok := l.calibration[chip][feature]; ok {
+		return cal.apply(value)
+	}
+	return value
+}
+
+// reading returns the reading of a feature of the named chip, calibrated,
+// and whether the calibrated value is plausible for the subsystem.  chipLabel
+// and device are the label values it is filtered under.  The caller holds
+// l.mu.
+func (l *LmSensorsCollector) reading(chip, feature, subsystem string, value float64, chipLabel, device string) (float64, bool) {
+	value = l.calibrate(chip, feature, value)
+	return value, l.plausible(subsystem, value, chipLabel, device)
+}
+
+// plausible reports whether a reading of the subsystem is within bounds, and
+// counts it as filtered otherwise.  The caller holds l.mu.
+func (l *LmSensorsCollector) plausible(subsystem string, value float64, chip, device string) bool {
+	b, ok := l.bounds[subsystem]
+	if !ok || b.contains(value) {
+		return true
+	}
+	slog.Debug("dropping implausible lm-sensors reading", "chip", chip, "subsystem", subsystem, "value", value)
+	l.filtered[[2]string{chip, device}]++
+	return false
+}
+
+func (l *LmSensorsCollector) chipWanted(name string) bool {
+	return chipWanted(l.chipInclude, l.chipExclude, name)
+}
+
+func (l *LmSensorsCollector) featureWanted(name string) bool {
+	return l.featExclude == nil || !l.featExclude.MatchString(name)
+}
+
+// labelOrName returns the label of a feature, or its name if the label is
+// empty, so that unlabeled features keep distinct label values.
+func labelOrName(label, name string) string {
+	if label != "" {
+		return label
+	}
+	return name
+}
+
+// chipWanted reports whether the chip name matches include, or if that is
+// nil, doesn't match exclude.
+func chipWanted(include, exclude *regexp.Regexp, name string) bool {
+	if include != nil {
+		return include.MatchString(name)
+	}
+	if exclude != nil {
+		return !exclude.MatchString(name)
+	}
+	return true
+}
+
 type (
 	HddCollector struct {
-		address string
-		conn    net.Conn
-		buf     bytes.Buffer
+		address  string
+		timeout  time.Duration
+		tempDesc *prometheus.Desc
+		upDesc   *prometheus.Desc
+		status   scrapeStatus
+
+		activeDesc      *prometheus.Desc
+		parseErrorsDesc *prometheus.Desc
+
+		// mu guards the connection backoff state, the resolved address and
+		// the parse error count below.
+		mu          sync.Mutex
+		failures    int
+		retryAt     time.Time
+		parseErrors int
+
+		// resolved holds the host:port addresses last resolved for a TCP
+		// address given by host name, reused for resolveInterval.
+		resolveInterval time.Duration
+		resolved        []string
+		resolvedAt      time.Time
+
+		// In streaming mode, when streamMaxAge is not 0, streamMu guards
+		// the connection kept open to the daemon, which is nil until
+		// connected.
+		streamMaxAge time.Duration
+		streamMu     sync.Mutex
+		stream       *hddtempStream
+
+		// now, dialTimeout and lookupIPAddr are time.Now, net.DialTimeout
+		// and net.DefaultResolver.LookupIPAddr, replaced in tests.
+		now          func() time.Time
+		dialTimeout  func(network, address string, timeout time.Duration) (net.Conn, error)
+		lookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
 	}
 
+	// HddTemperature is a drive listed by hddtemp.  Active is false for
+	// drives hddtemp reports without a temperature, such as sleeping ones,
+	// whose TemperatureCelsius is then meaningless.
 	HddTemperature struct {
 		Device             string
 		Id                 string
 		TemperatureCelsius float64
+		Active             bool
 	}
 )
 
-func NewHddCollector(address string) *HddCollector {
+// NewHddCollector returns a collector for the hddtemp daemon at address.  Its
+// metrics carry a source label so that several daemons can be registered
+// side by side.  If streamMaxAge is not 0, the daemon is expected to keep the
+// connection open and write a reading per line, rather than to write one
+// reading and close the connection, and the connection is reopened when no
+// reading arrived for streamMaxAge.  The IP of a host name is looked up again
+// after resolveInterval or a failed connection.
+func NewHddCollector(address string, timeout, resolveInterval, streamMaxAge time.Duration) *HddCollector {
 	return &HddCollector{
-		address: address,
+		address:         address,
+		timeout:         timeout,
+		resolveInterval: resolveInterval,
+		streamMaxAge:    streamMaxAge,
+		now:             time.Now,
+		dialTimeout:     net.DialTimeout,
+		lookupIPAddr:    net.DefaultResolver.LookupIPAddr,
+		tempDesc: prometheus.NewDesc(
+			"sensor_hddsmart_temperature_celsius",
+			"drive temperature in celsius as reported by the hddtemp daemon",
+			[]string{"device", "id"},
+			prometheus.Labels{"source": address}),
+		activeDesc: prometheus.NewDesc(
+			"sensor_hddsmart_drive_active",
+			"1 if hddtemp reports a temperature for the drive, 0 if it reports none, as for sleeping drives",
+			[]string{"device", "id"},
+			prometheus.Labels{"source": address}),
+		upDesc: prometheus.NewDesc(
+			"sensor_hddtemp_up",
+			"1 if the hddtemp daemon could be read and its output parsed, 0 otherwise",
+			nil,
+			prometheus.Labels{"source": address}),
+		parseErrorsDesc: prometheus.NewDesc(
+			"sensor_hddtemp_parse_errors_total",
+			"number of drive entries, or whole responses, from the hddtemp daemon that could not be parsed",
+			nil,
+			prometheus.Labels{"source": address}),
+		status: newScrapeStatus("hddtemp", address),
 	}
 }
 
+// Init checks that the hddtemp daemon is reachable.  A failure is not fatal:
+// the collector keeps retrying when scraped.
 func (h *HddCollector) Init() error {
-	conn, err := net.Dial("tcp", h.address)
+	conn, err := h.connect()
 	if err != nil {
-		return fmt.Errorf("error connecting to hddtemp address '%s': %v", h.address, err)
+		return err
 	}
-	h.conn = conn
-	return nil
+	return conn.Close()
 }
 
-func (h *HddCollector) readTempsFromConn() (string, error) {
-	if h.conn == nil {
-		if err := h.Init(); err != nil {
-			return "", err
+const (
+	hddtempMinBackoff = time.Second
+	hddtempMaxBackoff = time.Minute
+)
+
+// connect dials the hddtemp daemon, backing off exponentially between
+// hddtempMinBackoff and hddtempMaxBackoff after failed attempts so that a
+// daemon that is down isn't hammered by every scrape.
+func (h *HddCollector) connect() (net.Conn, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if now := h.now(); now.Before(h.retryAt) {
+		// The error stays the same while backing off, the time left is
+		// only logged.
+		slog.Debug("backing off from hddtemp", "address", h.address, "retry_in", h.retryAt.Sub(now).Round(time.Millisecond), "failed_attempts", h.failures)
+		return nil, fmt.Errorf("not retrying hddtemp address '%s': backing off after %d failed attempts", h.address, h.failures)
+	}
+	conn, err := h.dial()
+	if err != nil {
+		backoff := hddtempMinBackoff << uint(h.failures)
+		if backoff > hddtempMaxBackoff || backoff <= 0 {
+			backoff = hddtempMaxBackoff
+		}
+		h.failures++
+		h.retryAt = h.now().Add(backoff)
+		return nil, err
+	}
+	if h.failures > 0 {
+		slog.Info("reconnected to hddtemp", "address", h.address, "failed_attempts", h.failures)
+	}
+	h.failures = 0
+	h.retryAt = time.Time{}
+	return conn, nil
+}
+
+// hddtempNetwork splits an hddtemp address into the network and address to
+// dial: "unix:/path/to/socket" for a UNIX domain socket, host:port for TCP.
+func hddtempNetwork(address string) (network, addr string) {
+	if path := strings.TrimPrefix(address, "unix:"); path != address {
+		return "unix", path
+	}
+	return "tcp", address
+}
+
+// dial connects to the daemon.  The caller holds h.mu.
+func (h *HddCollector) dial() (net.Conn, error) {
+	network, addr := hddtempNetwork(h.address)
+	if network != "tcp" || h.resolveInterval == 0 {
+		conn, err := h.dialTimeout(network, addr, h.timeout)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to hddtemp address '%s': %v", h.address, err)
 		}
+		return conn, nil
 	}
 
-	_, err := io.Copy(&h.buf, h.conn)
+	cached := h.resolved != nil && h.now().Sub(h.resolvedAt) < h.resolveInterval
+	if !cached {
+		if err := h.resolve(addr); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := h.dialResolved()
+	if err != nil && cached {
+		// The host may have moved: look it up again before giving up.
+		if rerr := h.resolve(addr); rerr != nil {
+			return nil, rerr
+		}
+		conn, err = h.dialResolved()
+	}
 	if err != nil {
-		return "", fmt.Errorf("Error reading from hddtemp socket: %v", err)
+		h.resolved = nil
+		return nil, fmt.Errorf("error connecting to hddtemp address '%s': %v", h.address, err)
 	}
-	return h.buf.String(), nil
+	return conn, nil
 }
 
-func (h *HddCollector) Close() error {
-	if err := h.conn.Close(); err != nil {
-		return fmt.Errorf("Error closing hddtemp socket: %v", err)
+// dialResolved tries the resolved addresses in turn, as net.Dial does with
+// the addresses of a host name.  The caller holds h.mu.
+func (h *HddCollector) dialResolved() (net.Conn, error) {
+	var err error
+	for _, addr := range h.resolved {
+		var conn net.Conn
+		conn, err = h.dialTimeout("tcp", addr, h.timeout)
+		if err == nil {
+			return conn, nil
+		}
 	}
+	return nil, err
+}
+
+// resolve looks up the IPs of the host in addr and records them in
+// h.resolved.
+// The caller holds h.mu.
+func (h *HddCollector) resolve(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid hddtemp address '%s': %v", h.address, err)
+	}
+	ctx := context.Background()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	ips, err := h.lookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("error resolving hddtemp address '%s': %v", h.address, err)
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("error resolving hddtemp address '%s': no addresses found", h.address)
+	}
+	h.resolved = nil
+	for _, ip := range ips {
+		h.resolved = append(h.resolved, net.JoinHostPort(ip.String(), port))
+	}
+	h.resolvedAt = h.now()
 	return nil
 }
 
-func parseHddTemps(s string) ([]HddTemperature, error) {
-	var hddtemps []HddTemperature
-	if len(s) < 1 || s[0] != '|' {
-		return nil, fmt.Errorf("Error parsing output from hddtemp: %s", s)
+// readTempsFromConn dials a fresh connection on every call, since hddtemp
+// closes the socket after writing a single reading.
+func (h *HddCollector) readTempsFromConn() (string, error) {
+	conn, err := h.connect()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(h.timeout)); err != nil {
+		return "", fmt.Errorf("Error setting read deadline on hddtemp socket '%s': %v", h.address, err)
+	}
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, conn)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return "", fmt.Errorf("Timed out after %v reading from hddtemp socket '%s'", h.timeout, h.address)
+	} else if err != nil {
+		return "", fmt.Errorf("Error reading from hddtemp socket '%s': %v", h.address, err)
+	}
+	return buf.String(), nil
+}
+
+// parseHddTemps parses the output of hddtemp.  Proxies in front of several
+// daemons may send several frames, one per line, so the drives of all frames
+// are returned, a drive listed in several frames once, as last listed.
+// Entries that can't be parsed are skipped, with one error each in errs, so
+// that one bad entry doesn't cost the readings of the other drives.  A frame
+// that isn't a list of entries at all is a single error.  Output that is
+// empty or only whitespace is the single error ErrEmptyOutput.  Drives
+// without a temperature reading are returned inactive.
+func parseHddTemps(s string) (hddtemps []HddTemperature, errs []error) {
+	// hddtemp writes nothing when it watches no drives.
+	if strings.TrimSpace(s) == "" {
+		return nil, []error{ErrEmptyOutput}
+	}
+	seen := make(map[string]int)
+	for _, frame := range strings.Split(s, "\n") {
+		temps, frameErrs := parseHddFrame(frame)
+		errs = append(errs, frameErrs...)
+		for _, hddtemp := range temps {
+			if i, ok := seen[hddtemp.Device]; ok {
+				hddtemps[i] = hddtemp
+				continue
+			}
+			seen[hddtemp.Device] = len(hddtemps)
+			hddtemps = append(hddtemps, hddtemp)
+		}
+	}
+	return hddtemps, errs
+}
+
+// parseHddFrame parses one frame of hddtemp output, a list of entries such as
+// "|/dev/sda|WDC WD10EZEX|35|C|".
+func parseHddFrame(s string) (hddtemps []HddTemperature, errs []error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if len(s) < 2 || s[0] != '|' || s[len(s)-1] != '|' {
+		return nil, []error{fmt.Errorf("error parsing output from hddtemp, %w: %s", ErrBadFrame, s)}
 	}
 	for _, item := range strings.Split(s[1:len(s)-1], "||") {
 		hddtemp, err := parseHddTemp(item)
-		if err != nil {
-			return nil, fmt.Errorf("Error parsing output from hddtemp: %v", err)
-		} else {
-			hddtemps = append(hddtemps, hddtemp)
+		if errors.Is(err, errNoTemperature) {
+			slog.Debug("hddtemp drive without a temperature reading", "item", item)
+		} else if err != nil {
+			slog.Debug("skipping hddtemp drive", "item", item, "err", err)
+			errs = append(errs, err)
+			continue
 		}
+		hddtemps = append(hddtemps, hddtemp)
 	}
-	return hddtemps, nil
+	return hddtemps, errs
+}
+
+// errNoTemperature is returned by parseHddTemp, along with the device and id,
+// for drives hddtemp can't read the temperature of, such as sleeping ("SLP")
+// or unsupported drives.
+var errNoTemperature = errors.New("no temperature reading")
+
+// The errors parseHddTemps returns or wraps, for the ways hddtemp output can
+// fail to parse.  ErrEmptyOutput is for the whole output and ErrBadFrame for a
+// whole frame, the others for single entries.
+var (
+	ErrEmptyOutput    = errors.New("empty output")
+	ErrBadFrame       = errors.New("not a list of entries")
+	ErrFieldCount     = errors.New("expected at least 4 fields")
+	ErrBadUnit        = errors.New("unknown unit")
+	ErrBadTemperature = errors.New("temperature isn't a number")
+)
+
+// hddTempMarkers are the values hddtemp writes in place of a temperature.
+// They usually come with the "*" unit, but not always.
+var hddTempMarkers = map[string]bool{
+	"ERR": true,
+	"NA":  true,
+	"NOS": true,
+	"SLP": true,
+	"UNK": true,
+}
+
+// isHddTempUnit reports whether s is a unit as reported by hddtemp, "*"
+// standing for no reading.
+func isHddTempUnit(s string) bool {
+	return s == "C" || s == "F" || s == "*"
+}
+
+// hddTempFields picks the device, id, temperature and unit out of the fields
+// of an hddtemp entry.  The classic format has exactly these four fields.
+// Newer daemons may append extra fields after the unit, which are ignored.
+// Otherwise extra fields are taken to be part of the id, since drive ids can
+// themselves contain pipes: the device is taken from the front, the
+// temperature and unit from the back, and the rest is the id.
+func hddTempFields(pieces []string) (dev, id, temp, unit string) {
+	n := len(pieces)
+	if n > 4 && isHddTempUnit(pieces[3]) && !isHddTempUnit(pieces[n-1]) {
+		return pieces[0], pieces[1], pieces[2], pieces[3]
+	}
+	return pieces[0], strings.Join(pieces[1:n-2], "|"), pieces[n-2], pieces[n-1]
 }
 
 func parseHddTemp(s string) (HddTemperature, error) {
 	pieces := strings.Split(s, "|")
-	if len(pieces) != 4 {
-		return HddTemperature{}, fmt.Errorf("error parsing item from hddtemp, expected 4 tokens: %s", s)
+	if len(pieces) < 4 {
+		return HddTemperature{}, fmt.Errorf("error parsing item from hddtemp, %w: %s", ErrFieldCount, s)
 	}
-	dev, id, temp, unit := pieces[0], pieces[1], pieces[2], pieces[3]
+	dev, id, temp, unit := hddTempFields(pieces)
 
-	if unit == "*" {
-		return HddTemperature{Device: dev, Id: id, TemperatureCelsius: -1}, nil
+	if unit == "*" || hddTempMarkers[temp] {
+		return HddTemperature{Device: dev, Id: id}, errNoTemperature
 	}
 
-	if unit != "C" {
-		return HddTemperature{}, fmt.Errorf("error parsing item from hddtemp, I only speak Celsius", s)
+	if unit != "C" && unit != "F" {
+		return HddTemperature{}, fmt.Errorf("error parsing item from hddtemp, %w '%s': %s", ErrBadUnit, unit, s)
 	}
 
+	// Decimals and negative readings are valid, NaN and infinities aren't.
 	ftemp, err := strconv.ParseFloat(temp, 64)
-	if err != nil {
-		return HddTemperature{}, fmt.Errorf("Error parsing temperature as float: %s", temp)
+	if err != nil || math.IsNaN(ftemp) || math.IsInf(ftemp, 0) {
+		return HddTemperature{}, fmt.Errorf("error parsing item from hddtemp, %w: %s", ErrBadTemperature, temp)
+	}
+	if unit == "F" {
+		ftemp = (ftemp - 32) * 5 / 9
 	}
 
-	return HddTemperature{Device: dev, Id: id, TemperatureCelsius: ftemp}, nil
+	return HddTemperature{Device: dev, Id: id, TemperatureCelsius: ftemp, Active: true}, nil
+}
+
+// parseOutcome counts the parse errors parseHddTemps returned along with
+// hddtemps and tells, by their kind, whether the scrape failed.  Empty output
+// is a success with no drives.  Bad entries are skipped, and so is a bad frame
+// among frames that parse, though a bad frame means a daemon behind a proxy
+// isn't answering properly and is worth a warning.  Nothing usable is a failed
+// scrape.
+func (h *HddCollector) parseOutcome(hddtemps []HddTemperature, errs []error) error {
+	var parseErrors []error
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, ErrEmptyOutput):
+			continue
+		case errors.Is(err, ErrFieldCount), errors.Is(err, ErrBadUnit), errors.Is(err, ErrBadTemperature):
+			// Logged by parseHddFrame as the entry is skipped.
+		default:
+			slog.Warn("skipping hddtemp frame", "address", h.address, "err", err)
+		}
+		parseErrors = append(parseErrors, err)
+	}
+	h.mu.Lock()
+	h.parseErrors += len(parseErrors)
+	h.mu.Unlock()
+	if len(hddtemps) == 0 && len(parseErrors) > 0 {
+		return fmt.Errorf("error parsing temps from hddtemp daemon: %v", errors.Join(parseErrors...))
+	}
+	return nil
 }
 
 // Describe implements prometheus.Collector.
 func (e *HddCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- hddTempDesc
+	ch <- e.tempDesc
+	ch <- e.activeDesc
+	ch <- e.upDesc
+	ch <- e.parseErrorsDesc
+	e.status.describe(ch)
 }
 
 // Collect implements prometheus.Collector.
 func (h *HddCollector) Collect(ch chan<- prometheus.Metric) {
-	tempsString, err := h.readTempsFromConn()
+	begin := time.Now()
+	err := h.collect(ch)
+	up := 1.0
 	if err != nil {
-		log.Printf("error reading temps from hddtemp daemon: %v", err)
-		return
+		slog.Error("error collecting from hddtemp daemon", "address", h.address, "err", err)
+		up = 0
 	}
-	hddtemps, err := parseHddTemps(tempsString)
+	ch <- prometheus.MustNewConstMetric(h.upDesc, prometheus.GaugeValue, up)
+	h.mu.Lock()
+	parseErrors := h.parseErrors
+	h.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(h.parseErrorsDesc, prometheus.CounterValue, float64(parseErrors))
+	h.status.collect(ch, begin, err)
+}
+
+func (h *HddCollector) collect(ch chan<- prometheus.Metric) error {
+	read := h.readTempsFromConn
+	if h.streamMaxAge != 0 {
+		read = h.readTempsFromStream
+	}
+	tempsString, err := read()
 	if err != nil {
-		log.Printf("error parsing temps from hddtemp daemon: %v", err)
-		return
+		return fmt.Errorf("error reading temps from hddtemp daemon: %v", err)
+	}
+	hddtemps, errs := parseHddTemps(tempsString)
+	if err := h.parseOutcome(hddtemps, errs); err != nil {
+		return err
 	}
 
 	for _, ht := range hddtemps {
-		ch <- prometheus.MustNewConstMetric(hddTempDesc,
+		active := 0.0
+		if ht.Active {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(h.activeDesc,
+			prometheus.GaugeValue,
+			active,
+			ht.Device,
+			ht.Id)
+		if !ht.Active {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(h.tempDesc,
 			prometheus.GaugeValue,
 			ht.TemperatureCelsius,
 			ht.Device,
 			ht.Id)
 	}
+	return nil
 }
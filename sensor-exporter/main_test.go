@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLabelOrName(t *testing.T) {
+	for _, tc := range []struct {
+		label, name, want string
+	}{
+		{"Core 0", "temp2", "Core 0"},
+		{"", "temp1", "temp1"},
+	} {
+		if got := labelOrName(tc.label, tc.name); got != tc.want {
+			t.Errorf("labelOrName(%q, %q) = %q, want %q", tc.label, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLmSensorsReadingCalibration(t *testing.T) {
+	calibration := map[string]map[string]Calibration{
+		"it8728-isa-0a30": {
+			"temp1": {Scale: 1, Offset: -5},
+			"temp2": {Scale: 2, Offset: 1},
+			"temp4": {Scale: 0.5},
+		},
+	}
+	bounds := map[string]readingBounds{"temp": {min: math.Inf(-1), max: 100}}
+	l := NewLmSensorsCollector(nil, nil, nil, 0, false, bounds, calibration)
+
+	for _, tc := range []struct {
+		chip, feature string
+		raw, want     float64
+		plausible     bool
+	}{
+		{"it8728-isa-0a30", "temp1", 50, 45, true},
+		{"it8728-isa-0a30", "temp2", 40, 81, true},
+		// Filters see the calibrated value, above the bound here...
+		{"it8728-isa-0a30", "temp2", 50, 101, false},
+		// ...and within it here, though the raw value isn't.
+		{"it8728-isa-0a30", "temp4", 150, 75, true},
+		{"it8728-isa-0a30", "temp3", 150, 150, false},
+		{"coretemp-isa-0000", "temp1", 50, 50, true},
+	} {
+		got, plausible := l.reading(tc.chip, tc.feature, "temp", tc.raw, tc.chip, "")
+		if got != tc.want || plausible != tc.plausible {
+			t.Errorf("reading(%s, %s, %v) = %v, %v, want %v, %v", tc.chip, tc.feature, tc.raw, got, plausible, tc.want, tc.plausible)
+		}
+	}
+	if got := l.filtered[[2]string{"it8728-isa-0a30", ""}]; got != 2 {
+		t.Errorf("%d readings of it8728-isa-0a30 filtered, want 2", got)
+	}
+}
+
+func TestClassifyFeature(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		subsystem string
+		ok        bool
+	}{
+		{"in0", "in", true},
+		{"in12", "in", true},
+		{"intrusion0", "intrusion", true},
+		{"info", "", false},
+		{"in", "", false},
+		{"temp1", "temp", true},
+		{"fan3", "fan", true},
+		{"humidity1", "humidity", true},
+		{"energy1", "energy", true},
+		{"curr1", "curr", true},
+		{"power1", "power", true},
+		{"beep_enable", "", false},
+		{"vid3", "", false},
+	} {
+		subsystem, ok := classifyFeature(tc.name)
+		if ok != tc.ok || ok && subsystem != tc.subsystem {
+			t.Errorf("classifyFeature(%q) = %q, %v, want %q, %v", tc.name, subsystem, ok, tc.subsystem, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// metadataGatherer applies MetricMetadata, keyed by family name as served,
+// to the families gathered from a Gatherer.
+type metadataGatherer struct {
+	gatherer prometheus.Gatherer
+	metadata map[string]MetricMetadata
+}
+
+// newMetadataGatherer returns g itself if metadata is empty.
+func newMetadataGatherer(g prometheus.Gatherer, metadata map[string]MetricMetadata) prometheus.Gatherer {
+	if len(metadata) == 0 {
+		return g
+	}
+	return &metadataGatherer{gatherer: g, metadata: metadata}
+}
+
+// Gather implements prometheus.Gatherer.
+func (m *metadataGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := m.gatherer.Gather()
+	for _, mf := range mfs {
+		md, ok := m.metadata[mf.GetName()]
+		if !ok {
+			continue
+		}
+		if md.Help != nil {
+			mf.Help = proto.String(*md.Help)
+		}
+		for _, metric := range mf.GetMetric() {
+			addLabels(metric, md.Labels)
+		}
+	}
+	return mfs, err
+}
+
+// addLabels adds labels to a metric, keeping its label pairs sorted by name.
+// Labels the metric already has keep their value.
+func addLabels(metric *dto.Metric, labels map[string]string) {
+	have := make(map[string]bool)
+	for _, lp := range metric.GetLabel() {
+		have[lp.GetName()] = true
+	}
+	for name, value := range labels {
+		if have[name] {
+			continue
+		}
+		metric.Label = append(metric.Label, &dto.LabelPair{
+			Name:  proto.String(name),
+			Value: proto.String(value),
+		})
+	}
+	sort.Slice(metric.Label, func(i, j int) bool {
+		return metric.Label[i].GetName() < metric.Label[j].GetName()
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultNamespace = "sensor"
+	defaultSubsystem = "lm"
+)
+
+// renamingGatherer replaces the sensor_ and sensor_lm_ prefixes of the metric
+// names gathered from a Gatherer, so that operators can fit the metrics into
+// their own naming scheme.  Other metrics, such as go_*, are left alone.
+type renamingGatherer struct {
+	gatherer  prometheus.Gatherer
+	namespace string
+	subsystem string
+}
+
+// newRenamingGatherer returns g itself if namespace and subsystem are the
+// defaults.
+func newRenamingGatherer(g prometheus.Gatherer, namespace, subsystem string) prometheus.Gatherer {
+	if namespace == defaultNamespace && subsystem == defaultSubsystem {
+		return g
+	}
+	return &renamingGatherer{gatherer: g, namespace: namespace, subsystem: subsystem}
+}
+
+// Gather implements prometheus.Gatherer.
+func (r *renamingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := r.gatherer.Gather()
+	for _, mf := range mfs {
+		mf.Name = proto.String(r.rename(mf.GetName()))
+	}
+	sort.Slice(mfs, func(i, j int) bool {
+		return mfs[i].GetName() < mfs[j].GetName()
+	})
+	return mfs, err
+}
+
+func (r *renamingGatherer) rename(name string) string {
+	if rest, ok := strings.CutPrefix(name, defaultNamespace+"_"+defaultSubsystem+"_"); ok {
+		return joinMetricName(r.namespace, r.subsystem, rest)
+	}
+	if rest, ok := strings.CutPrefix(name, defaultNamespace+"_"); ok {
+		return joinMetricName(r.namespace, rest)
+	}
+	return name
+}
+
+// joinMetricName joins the non-empty parts of a metric name with underscores.
+func joinMetricName(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, "_")
+}
+
+// validateMetricPrefix checks that namespace and subsystem yield valid metric
+// names.
+func validateMetricPrefix(namespace, subsystem string) error {
+	if namespace == "" {
+		return fmt.Errorf("namespace must not be empty")
+	}
+	if name := joinMetricName(namespace, subsystem, "x"); !model.IsValidLegacyMetricName(name) {
+		return fmt.Errorf("'%s' is not a valid metric name prefix", strings.TrimSuffix(name, "x"))
+	}
+	return nil
+}
+
+// labelsFlag is a repeatable flag of constant labels, each given as
+// name=value.  Several can also be given at once, separated by commas.
+type labelsFlag prometheus.Labels
+
+// String implements flag.Value.
+func (l labelsFlag) String() string {
+	pairs := make([]string, 0, len(l))
+	for name, value := range l {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set implements flag.Value.
+func (l labelsFlag) Set(s string) error {
+	for _, pair := range splitList(s) {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("expected name=value, got %q", pair)
+		}
+		if err := validateExtraLabel(name); err != nil {
+			return err
+		}
+		if _, dup := l[name]; dup {
+			return fmt.Errorf("label %q given twice", name)
+		}
+		l[name] = value
+	}
+	return nil
+}
+
+// validateExtraLabel checks that name can be added as a constant label.
+// Names starting with __ are reserved by Prometheus.
+func validateExtraLabel(name string) error {
+	if !model.LabelName(name).IsValidLegacy() {
+		return fmt.Errorf("invalid label name %q", name)
+	}
+	if strings.HasPrefix(name, "__") {
+		return fmt.Errorf("label name %q is reserved", name)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	upsVariableDesc = prometheus.NewDesc(
+		"sensor_ups_variable",
+		"numeric UPS variable reported by upsd",
+		[]string{"ups", "variable"},
+		nil)
+
+	// upsVariableDescs holds the UPS variables exported under their own
+	// metric name instead of sensor_ups_variable.
+	upsVariableDescs = map[string]*prometheus.Desc{
+		"battery.charge":  newUpsDesc("sensor_ups_battery_charge_percent", "battery charge in percent"),
+		"battery.runtime": newUpsDesc("sensor_ups_battery_runtime_seconds", "remaining battery runtime in seconds"),
+		"battery.voltage": newUpsDesc("sensor_ups_battery_voltage_volts", "battery voltage in volts"),
+		"input.voltage":   newUpsDesc("sensor_ups_input_voltage_volts", "input voltage in volts"),
+		"output.voltage":  newUpsDesc("sensor_ups_output_voltage_volts", "output voltage in volts"),
+		"ups.load":        newUpsDesc("sensor_ups_load_percent", "load in percent of the UPS capacity"),
+	}
+)
+
+func newUpsDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(name, help, []string{"ups"}, nil)
+}
+
+// NutCollector exports the variables of the UPSes served by a Network UPS
+// Tools daemon (upsd).  Like HddCollector it connects afresh on every scrape.
+type NutCollector struct {
+	address  string
+	ups      []string
+	username string
+	password string
+	timeout  time.Duration
+	status   scrapeStatus
+}
+
+// NewNutCollector returns a collector for the named UPSes at the upsd address,
+// or for every UPS it serves if ups is empty.  No login is attempted if
+// username is empty.
+func NewNutCollector(address string, ups []string, username, password string, timeout time.Duration) *NutCollector {
+	return &NutCollector{
+		address:  address,
+		ups:      ups,
+		username: username,
+		password: password,
+		timeout:  timeout,
+		status:   newScrapeStatus("nut", address),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (n *NutCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upsVariableDesc
+	for _, desc := range upsVariableDescs {
+		ch <- desc
+	}
+	n.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (n *NutCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := n.collect(ch)
+	if err != nil {
+		slog.Error("error collecting from upsd", "address", n.address, "err", err)
+	}
+	n.status.collect(ch, begin, err)
+}
+
+func (n *NutCollector) collect(ch chan<- prometheus.Metric) error {
+	conn, err := net.DialTimeout("tcp", n.address, n.timeout)
+	if err != nil {
+		return fmt.Errorf("error connecting to upsd address '%s': %v", n.address, err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(n.timeout)); err != nil {
+		return fmt.Errorf("error setting deadline on upsd socket '%s': %v", n.address, err)
+	}
+
+	c := &nutClient{conn: conn, r: bufio.NewReader(conn)}
+	defer c.command("LOGOUT")
+	if n.username != "" {
+		if _, err := c.command("USERNAME " + n.username); err != nil {
+			return err
+		}
+		if _, err := c.command("PASSWORD " + n.password); err != nil {
+			return err
+		}
+	}
+
+	upsNames := n.ups
+	if len(upsNames) == 0 {
+		lines, err := c.list("UPS")
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			// UPS <upsname> "<description>"
+			if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "UPS" {
+				upsNames = append(upsNames, fields[1])
+			}
+		}
+	}
+
+	for _, ups := range upsNames {
+		lines, err := c.list("VAR " + ups)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			name, value, ok := parseNutVar(line)
+			if !ok {
+				continue
+			}
+			fvalue, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				// Plenty of variables, such as ups.status, are not numbers.
+				continue
+			}
+			if desc, ok := upsVariableDescs[name]; ok {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, fvalue, ups)
+			} else {
+				ch <- prometheus.MustNewConstMetric(upsVariableDesc, prometheus.GaugeValue, fvalue, ups, name)
+			}
+		}
+	}
+	return nil
+}
+
+// parseNutVar parses a `VAR <upsname> <varname> "<value>"` line.
+func parseNutVar(line string) (name, value string, ok bool) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 || fields[0] != "VAR" {
+		return "", "", false
+	}
+	value, err := strconv.Unquote(fields[3])
+	if err != nil {
+		return "", "", false
+	}
+	return fields[2], value, true
+}
+
+// nutClient speaks the upsd network protocol over a single connection.
+type nutClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// command sends cmd and returns the first line of the reply.
+func (c *nutClient) command(cmd string) (string, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\n", cmd); err != nil {
+		return "", fmt.Errorf("error writing to upsd: %v", err)
+	}
+	return c.readLine()
+}
+
+func (c *nutClient) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("error reading from upsd: %v", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "ERR ") {
+		return "", fmt.Errorf("upsd replied %s", line)
+	}
+	return line, nil
+}
+
+// list runs `LIST <query>` and returns the lines between BEGIN and END.
+func (c *nutClient) list(query string) ([]string, error) {
+	line, err := c.command("LIST " + query)
+	if err != nil {
+		return nil, err
+	}
+	if line != "BEGIN LIST "+query {
+		return nil, fmt.Errorf("unexpected reply from upsd to LIST %s: %s", query, line)
+	}
+	var lines []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "END LIST "+query {
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var nvmeTempDesc = prometheus.NewDesc(
+	"sensor_nvme_temperature_celsius",
+	"NVMe temperature in celsius as reported by smartctl",
+	[]string{"device", "sensor"},
+	nil)
+
+// smartctlOutput is the part of `smartctl -A -j` output we use.
+type smartctlOutput struct {
+	Temperature struct {
+		Current *float64 `json:"current"`
+	} `json:"temperature"`
+	NvmeSmartHealthInformationLog struct {
+		TemperatureSensors []float64 `json:"temperature_sensors"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+// NvmeCollector exports NVMe drive temperatures, which hddtemp doesn't report,
+// by running smartctl against each drive.
+type NvmeCollector struct {
+	smartctl string
+	devices  []string
+	sysfs    string
+	timeout  time.Duration
+	status   scrapeStatus
+}
+
+// NewNvmeCollector returns a collector running the smartctl binary against
+// devices, or if devices is empty, against every controller found under sysfs.
+// smartctl is killed if a scrape takes longer than timeout, unless it is 0.
+func NewNvmeCollector(smartctl string, devices []string, sysfs string, timeout time.Duration) *NvmeCollector {
+	return &NvmeCollector{
+		smartctl: smartctl,
+		devices:  devices,
+		sysfs:    sysfs,
+		timeout:  timeout,
+		status:   newScrapeStatus("nvme", ""),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (n *NvmeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nvmeTempDesc
+	n.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (n *NvmeCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := n.collect(ch)
+	if err != nil {
+		slog.Error("error reading NVMe temperatures", "err", err)
+	}
+	n.status.collect(ch, begin, err)
+}
+
+func (n *NvmeCollector) collect(ch chan<- prometheus.Metric) error {
+	devices := n.devices
+	if len(devices) == 0 {
+		controllers, err := filepath.Glob(filepath.Join(n.sysfs, "class/nvme/nvme*"))
+		if err != nil {
+			return err
+		}
+		for _, controller := range controllers {
+			devices = append(devices, "/dev/"+filepath.Base(controller))
+		}
+	}
+
+	ctx, cancel := collectContext(n.timeout)
+	defer cancel()
+	var lastErr error
+	for _, device := range devices {
+		out, err := n.readSmartctl(ctx, device)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		name := filepath.Base(device)
+		if out.Temperature.Current != nil {
+			ch <- prometheus.MustNewConstMetric(nvmeTempDesc,
+				prometheus.GaugeValue,
+				*out.Temperature.Current,
+				name, "composite")
+		}
+		for i, temp := range out.NvmeSmartHealthInformationLog.TemperatureSensors {
+			ch <- prometheus.MustNewConstMetric(nvmeTempDesc,
+				prometheus.GaugeValue,
+				temp,
+				name, strconv.Itoa(i+1))
+		}
+	}
+	return lastErr
+}
+
+func (n *NvmeCollector) readSmartctl(ctx context.Context, device string) (*smartctlOutput, error) {
+	data, err := exec.CommandContext(ctx, n.smartctl, "-A", "-j", device).Output()
+	// smartctl's exit status is a bit mask; only bits 0 and 1 mean that it
+	// couldn't read the device.  The others report on the drive's health.
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode()&0x3 == 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error running %s on %s: %v", n.smartctl, device, err)
+	}
+	var out smartctlOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("error parsing smartctl output for %s: %v", device, err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// diskTemperatureMetrics are the per-disk temperature families that pools
+// aggregate, all with a "device" label such as "sda" or "/dev/sda".
+var diskTemperatureMetrics = map[string]bool{
+	"sensor_disk_temperature_celsius":     true,
+	"sensor_hddsmart_temperature_celsius": true,
+	"sensor_nvme_temperature_celsius":     true,
+}
+
+const (
+	poolMaxName = "sensor_pool_temperature_max_celsius"
+	poolMaxHelp = "highest temperature in celsius of the disks of the pool"
+	poolAvgName = "sensor_pool_temperature_avg_celsius"
+	poolAvgHelp = "average temperature in celsius of the disks of the pool"
+)
+
+// poolGatherer adds, to the families gathered from a Gatherer, the maximum
+// and average temperature of the disks of each configured pool, such as a
+// zfs pool or an md array.  It is a post-processing step: it reads the disk
+// temperatures the drivetemp, hddtemp and nvme collectors already exported.
+type poolGatherer struct {
+	gatherer prometheus.Gatherer
+	// pools maps device names, without /dev/, to the pools they belong to.
+	pools   map[string][]string
+	maxDesc *prometheus.Desc
+	avgDesc *prometheus.Desc
+}
+
+// newPoolGatherer returns a gatherer aggregating the disk temperatures from
+// g by pool.  pools maps pool names to their devices, such as "sda" or
+// "/dev/nvme0".  The pool metrics carry constLabels.
+func newPoolGatherer(g prometheus.Gatherer, pools map[string][]string, constLabels prometheus.Labels) *poolGatherer {
+	p := &poolGatherer{
+		gatherer: g,
+		pools:    make(map[string][]string),
+		maxDesc:  prometheus.NewDesc(poolMaxName, poolMaxHelp, []string{"pool"}, constLabels),
+		avgDesc:  prometheus.NewDesc(poolAvgName, poolAvgHelp, []string{"pool"}, constLabels),
+	}
+	for pool, devices := range pools {
+		for _, device := range devices {
+			device = filepath.Base(device)
+			p.pools[device] = append(p.pools[device], pool)
+		}
+	}
+	return p
+}
+
+// Gather implements prometheus.Gatherer.
+func (p *poolGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := p.gatherer.Gather()
+
+	// A disk may be reported by several collectors, or by several sensors
+	// as NVMe drives are, so each disk counts once, at its hottest.
+	disks := make(map[string]float64)
+	for _, mf := range mfs {
+		if !diskTemperatureMetrics[mf.GetName()] {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() != "device" {
+					continue
+				}
+				device := filepath.Base(lp.GetValue())
+				if value, ok := disks[device]; !ok || m.GetGauge().GetValue() > value {
+					disks[device] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+
+	type stats struct {
+		max, sum float64
+		count    int
+	}
+	pools := make(map[string]*stats)
+	for device, value := range disks {
+		for _, pool := range p.pools[device] {
+			s, ok := pools[pool]
+			if !ok {
+				s = &stats{max: value}
+				pools[pool] = s
+			}
+			if value > s.max {
+				s.max = value
+			}
+			s.sum += value
+			s.count++
+		}
+	}
+	if len(pools) == 0 {
+		return mfs, err
+	}
+
+	names := make([]string, 0, len(pools))
+	for pool := range pools {
+		names = append(names, pool)
+	}
+	sort.Strings(names)
+	maxFamily := newGaugeFamily(poolMaxName, poolMaxHelp)
+	avgFamily := newGaugeFamily(poolAvgName, poolAvgHelp)
+	for _, pool := range names {
+		s := pools[pool]
+		maxFamily.Metric = append(maxFamily.Metric, writeMetric(prometheus.MustNewConstMetric(p.maxDesc, prometheus.GaugeValue, s.max, pool)))
+		avgFamily.Metric = append(avgFamily.Metric, writeMetric(prometheus.MustNewConstMetric(p.avgDesc, prometheus.GaugeValue, s.sum/float64(s.count), pool)))
+	}
+	return append(mfs, avgFamily, maxFamily), err
+}
+
+// newGaugeFamily returns an empty gauge family.
+func newGaugeFamily(name, help string) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name: proto.String(name),
+		Help: proto.String(help),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+}
+
+// writeMetric returns the protobuf form of a const metric, which can't fail.
+func writeMetric(m prometheus.Metric) *dto.Metric {
+	var d dto.Metric
+	if err := m.Write(&d); err != nil {
+		panic(err)
+	}
+	return &d
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/fs"
+	"log/slog"
+	"path"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	powerSupplyVoltageDesc = prometheus.NewDesc(
+		"sensor_power_supply_voltage_volts",
+		"power supply voltage in volts",
+		[]string{"supply", "type"},
+		nil)
+
+	powerSupplyCurrentDesc = prometheus.NewDesc(
+		"sensor_power_supply_current_amperes",
+		"power supply current in amperes",
+		[]string{"supply", "type"},
+		nil)
+
+	powerSupplyCapacityDesc = prometheus.NewDesc(
+		"sensor_power_supply_capacity_ratio",
+		"battery charge as a ratio of its capacity",
+		[]string{"supply", "type"},
+		nil)
+
+	// powerSupplyAttributes maps the power_supply attribute files we read to
+	// their metric and the factor converting them to base units.
+	powerSupplyAttributes = []struct {
+		file  string
+		desc  *prometheus.Desc
+		scale float64
+	}{
+		{"voltage_now", powerSupplyVoltageDesc, 1e-6},
+		{"current_now", powerSupplyCurrentDesc, 1e-6},
+		{"capacity", powerSupplyCapacityDesc, 1e-2},
+	}
+)
+
+// PowerSupplyCollector exports the batteries and mains adapters the kernel
+// reports under /sys/class/power_supply, as found on laptops and SBCs.
+type PowerSupplyCollector struct {
+	sysfs  sysfsTree
+	status scrapeStatus
+}
+
+// NewPowerSupplyCollector returns a collector reading the power supplies of
+// sysfs.
+func NewPowerSupplyCollector(sysfs sysfsTree) *PowerSupplyCollector {
+	return &PowerSupplyCollector{
+		sysfs:  sysfs,
+		status: newScrapeStatus("power_supply", sysfs.host()),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (p *PowerSupplyCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, attr := range powerSupplyAttributes {
+		ch <- attr.desc
+	}
+	p.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (p *PowerSupplyCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := p.collect(ch)
+	if err != nil {
+		slog.Error("error reading power supplies", "err", err)
+	}
+	p.status.collect(ch, begin, err)
+}
+
+func (p *PowerSupplyCollector) collect(ch chan<- prometheus.Metric) error {
+	fsys, err := p.sysfs.open()
+	if err != nil {
+		return err
+	}
+	dirs, err := fs.Glob(fsys, "class/power_supply/*")
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		supply := path.Base(dir)
+		supplyType, err := readSysfsString(fsys, path.Join(dir, "type"))
+		if err != nil {
+			slog.Debug("skipping power supply", "path", dir, "err", err)
+			continue
+		}
+		// Not every supply has every attribute: mains adapters have no
+		// capacity, and many batteries lack current_now.
+		for _, attr := range powerSupplyAttributes {
+			value, err := readSysfsInt(fsys, path.Join(dir, attr.file))
+			if err != nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(attr.desc,
+				prometheus.GaugeValue,
+				float64(value)*attr.scale,
+				supply, supplyType)
+		}
+	}
+	return nil
+}
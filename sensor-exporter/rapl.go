@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var raplEnergyDesc = prometheus.NewDesc(
+	"sensor_rapl_energy_joules_total",
+	"energy consumed by the RAPL zone in joules, resetting when the hardware counter wraps around",
+	[]string{"zone", "name"},
+	nil)
+
+// RaplCollector exports the energy counters of the Intel RAPL (Running
+// Average Power Limit) zones under /sys/class/powercap, for packages, cores
+// and DRAM, for power draw through rate().  The counters wrap around at
+// max_energy_range_uj, which shows as a counter reset.
+type RaplCollector struct {
+	sysfs  sysfsTree
+	status scrapeStatus
+}
+
+// NewRaplCollector returns a collector reading the RAPL zones of sysfs.
+func NewRaplCollector(sysfs sysfsTree) *RaplCollector {
+	return &RaplCollector{
+		sysfs:  sysfs,
+		status: newScrapeStatus("rapl", sysfs.host()),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (r *RaplCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- raplEnergyDesc
+	r.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (r *RaplCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := r.collect(ch)
+	if err != nil {
+		slog.Error("error reading RAPL zones", "err", err)
+	}
+	r.status.collect(ch, begin, err)
+}
+
+func (r *RaplCollector) collect(ch chan<- prometheus.Metric) error {
+	fsys, err := r.sysfs.open()
+	if err != nil {
+		return err
+	}
+	dirs, err := fs.Glob(fsys, "class/powercap/intel-rapl:*")
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		microjoules, err := readSysfsInt(fsys, path.Join(dir, "energy_uj"))
+		if errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("%v: kernels since 5.10 only let root read the RAPL counters", err)
+		} else if err != nil {
+			slog.Debug("skipping RAPL zone", "path", dir, "err", err)
+			continue
+		}
+		name, err := readSysfsString(fsys, path.Join(dir, "name"))
+		if err != nil {
+			slog.Debug("skipping RAPL zone", "path", dir, "err", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(raplEnergyDesc,
+			prometheus.CounterValue,
+			float64(microjoules)/1e6,
+			strings.TrimPrefix(path.Base(dir), "intel-rapl:"), name)
+	}
+	return nil
+}
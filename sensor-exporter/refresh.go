@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// refreshHandler runs every collector of g once on POST, after dropping the
+// lm-sensors cache if lm isn't nil, and answers when they are done.  The
+// other collectors read the hardware on every scrape and have no cache to
+// drop, so for them this is just an early scrape.
+func refreshHandler(g prometheus.Gatherer, lm *LmSensorsCollector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if lm != nil {
+			lm.Invalidate()
+		}
+		families, err := g.Gather()
+		if err != nil {
+			slog.Error("error refreshing collectors", "err", err)
+			http.Error(w, fmt.Sprintf("error refreshing collectors: %v", err), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "refreshed, %d metric families gathered\n", len(families))
+	})
+}
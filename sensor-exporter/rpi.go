@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	rpiTemperatureDesc = prometheus.NewDesc(
+		"sensor_rpi_temperature_celsius",
+		"SoC temperature in celsius as reported by vcgencmd measure_temp",
+		nil,
+		nil)
+
+	rpiThrottledDesc = prometheus.NewDesc(
+		"sensor_rpi_throttled",
+		"1 if the firmware currently reports the throttling condition, 0 otherwise",
+		[]string{"reason"},
+		nil)
+
+	rpiThrottledSinceBootDesc = prometheus.NewDesc(
+		"sensor_rpi_throttled_since_boot",
+		"1 if the firmware reported the throttling condition since boot, 0 otherwise",
+		[]string{"reason"},
+		nil)
+
+	// rpiThrottledReasons names the bits of vcgencmd get_throttled.  Each
+	// is mirrored 16 bits up by a bit that stays set until reboot.
+	rpiThrottledReasons = []struct {
+		bit    uint
+		reason string
+	}{
+		{0, "under_voltage"},
+		{1, "freq_capped"},
+		{2, "throttled"},
+		{3, "soft_temp_limit"},
+	}
+)
+
+// RpiCollector exports the Raspberry Pi SoC temperature and throttling state
+// as reported by the firmware through vcgencmd.
+type RpiCollector struct {
+	vcgencmd string
+	timeout  time.Duration
+	status   scrapeStatus
+}
+
+// NewRpiCollector returns a collector running the vcgencmd binary, killed if
+// a scrape takes longer than timeout, unless that is 0.
+func NewRpiCollector(vcgencmd string, timeout time.Duration) *RpiCollector {
+	return &RpiCollector{
+		vcgencmd: vcgencmd,
+		timeout:  timeout,
+		status:   newScrapeStatus("rpi", ""),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (r *RpiCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rpiTemperatureDesc
+	ch <- rpiThrottledDesc
+	ch <- rpiThrottledSinceBootDesc
+	r.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (r *RpiCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := r.collect(ch)
+	if err != nil {
+		slog.Error("error reading vcgencmd", "err", err)
+	}
+	r.status.collect(ch, begin, err)
+}
+
+func (r *RpiCollector) collect(ch chan<- prometheus.Metric) error {
+	ctx, cancel := collectContext(r.timeout)
+	defer cancel()
+	out, err := r.run(ctx, "measure_temp")
+	if err != nil {
+		return err
+	}
+	temp, err := parseVcgencmdTemp(out)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(rpiTemperatureDesc,
+		prometheus.GaugeValue,
+		temp)
+
+	out, err = r.run(ctx, "get_throttled")
+	if err != nil {
+		return err
+	}
+	throttled, err := parseVcgencmdThrottled(out)
+	if err != nil {
+		return err
+	}
+	for _, t := range rpiThrottledReasons {
+		ch <- prometheus.MustNewConstMetric(rpiThrottledDesc,
+			prometheus.GaugeValue,
+			float64(throttled>>t.bit&1),
+			t.reason)
+		ch <- prometheus.MustNewConstMetric(rpiThrottledSinceBootDesc,
+			prometheus.GaugeValue,
+			float64(throttled>>(t.bit+16)&1),
+			t.reason)
+	}
+	return nil
+}
+
+func (r *RpiCollector) run(ctx context.Context, command string) (string, error) {
+	out, err := exec.CommandContext(ctx, r.vcgencmd, command).Output()
+	if err != nil {
+		return "", fmt.Errorf("error running %s %s: %v", r.vcgencmd, command, err)
+	}
+	return string(out), nil
+}
+
+// parseVcgencmdTemp parses the output of vcgencmd measure_temp, such as
+// "temp=47.2'C".
+func parseVcgencmdTemp(out string) (float64, error) {
+	s, ok := strings.CutPrefix(strings.TrimSpace(out), "temp=")
+	if !ok {
+		return 0, fmt.Errorf("unexpected vcgencmd measure_temp output '%s'", strings.TrimSpace(out))
+	}
+	return strconv.ParseFloat(strings.TrimSuffix(s, "'C"), 64)
+}
+
+// parseVcgencmdThrottled parses the output of vcgencmd get_throttled, such as
+// "throttled=0x50005".
+func parseVcgencmdThrottled(out string) (uint64, error) {
+	s, ok := strings.CutPrefix(strings.TrimSpace(out), "throttled=")
+	if !ok {
+		return 0, fmt.Errorf("unexpected vcgencmd get_throttled output '%s'", strings.TrimSpace(out))
+	}
+	return strconv.ParseUint(s, 0, 32)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// jsonFamilies maps the sensor metric families served as JSON to the type
+// and unit of their readings and the label naming the feature.
+var jsonFamilies = map[string]struct {
+	kind, unit, feature string
+}{
+	"sensor_lm_current_amperes":           {"current", "amperes", "currtype"},
+	"sensor_lm_energy_joules_total":       {"energy", "joules", "energytype"},
+	"sensor_lm_fan_speed_rpm":             {"fan", "rpm", "fantype"},
+	"sensor_lm_humidity_percent":          {"humidity", "percent", "humiditytype"},
+	"sensor_lm_power_watts":               {"power", "watts", "powertype"},
+	"sensor_lm_temperature_celsius":       {"temperature", "celsius", "temptype"},
+	"sensor_lm_voltage_volts":             {"voltage", "volts", "intype"},
+	"sensor_hddsmart_temperature_celsius": {"temperature", "celsius", "id"},
+}
+
+// jsonReading is one reading as served by /sensors.json.  Readings from
+// hddtemp name the drive's device as the chip and its model as the feature.
+type jsonReading struct {
+	Source  string  `json:"source"`
+	Chip    string  `json:"chip"`
+	Feature string  `json:"feature"`
+	Type    string  `json:"type"`
+	Value   float64 `json:"value"`
+	Unit    string  `json:"unit"`
+}
+
+// jsonHandler serves the readings gathered from g, the registry behind the
+// metrics endpoint, as a JSON array.
+func jsonHandler(g prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families, err := g.Gather()
+		if err != nil {
+			slog.Error("error gathering metrics for JSON", "err", err)
+		}
+		readings := jsonReadings(families)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(readings); err != nil {
+			slog.Error("error writing JSON readings", "err", err)
+		}
+	})
+}
+
+func jsonReadings(families []*dto.MetricFamily) []jsonReading {
+	readings := []jsonReading{}
+	for _, mf := range families {
+		f, ok := jsonFamilies[mf.GetName()]
+		if !ok {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			chip := labels["chip"]
+			if chip == "" {
+				chip = labels["device"]
+			}
+			value := m.GetGauge().GetValue()
+			if m.Counter != nil {
+				value = m.GetCounter().GetValue()
+			}
+			readings = append(readings, jsonReading{
+				Source:  labels["source"],
+				Chip:    chip,
+				Feature: labels[f.feature],
+				Type:    f.kind,
+				Value:   value,
+				Unit:    f.unit,
+			})
+		}
+	}
+	sort.SliceStable(readings, func(i, j int) bool {
+		a, b := readings[i], readings[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Chip != b.Chip {
+			return a.Chip < b.Chip
+		}
+		return a.Feature < b.Feature
+	})
+	return readings
+}
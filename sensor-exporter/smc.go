@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	smcFanspeedDesc    = newFanspeedDesc("smc")
+	smcTemperatureDesc = newTemperatureDesc("smc")
+)
+
+// smcTemperatureKeys maps the SMC keys of common temperature sensors to the
+// name they are exported under.  Keys a machine doesn't have are skipped.
+var smcTemperatureKeys = map[string]string{
+	"TA0P": "Ambient",
+	"TB0T": "Battery",
+	"TC0D": "CPU Die",
+	"TC0E": "CPU Die (PECI)",
+	"TC0F": "CPU Die (filtered)",
+	"TC0P": "CPU Proximity",
+	"TG0D": "GPU Die",
+	"TG0P": "GPU Proximity",
+	"Th0H": "Heatsink",
+	"TM0P": "Memory Proximity",
+	"Ts0P": "Palm Rest",
+}
+
+// SMCCollector exports the temperatures and fan speeds of the System
+// Management Controller of Macs, in the lm-sensors families with
+// source="smc".
+type SMCCollector struct {
+	status scrapeStatus
+}
+
+func NewSMCCollector() *SMCCollector {
+	return &SMCCollector{status: newScrapeStatus("smc", "")}
+}
+
+// Describe implements prometheus.Collector.
+func (s *SMCCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- smcFanspeedDesc
+	ch <- smcTemperatureDesc
+	s.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (s *SMCCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := s.collect(ch)
+	if err != nil {
+		slog.Error("error reading SMC", "err", err)
+	}
+	s.status.collect(ch, begin, err)
+}
@@ -0,0 +1,165 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#cgo LDFLAGS: -framework IOKit
+#include <IOKit/IOKitLib.h>
+#include <string.h>
+
+// The structure exchanged with the AppleSMC kernel extension.
+typedef struct {
+	char major;
+	char minor;
+	char build;
+	char reserved[1];
+	UInt16 release;
+} smcVersion;
+
+typedef struct {
+	UInt16 version;
+	UInt16 length;
+	UInt32 cpuPLimit;
+	UInt32 gpuPLimit;
+	UInt32 memPLimit;
+} smcPLimitData;
+
+typedef struct {
+	UInt32 dataSize;
+	UInt32 dataType;
+	char dataAttributes;
+} smcKeyInfo;
+
+typedef struct {
+	UInt32 key;
+	smcVersion vers;
+	smcPLimitData pLimitData;
+	smcKeyInfo keyInfo;
+	char result;
+	char status;
+	char data8;
+	UInt32 data32;
+	unsigned char bytes[32];
+} smcKeyData;
+
+#define SMC_KERNEL_INDEX 2
+#define SMC_CMD_READ_BYTES 5
+#define SMC_CMD_READ_KEYINFO 9
+
+static kern_return_t smcOpen(io_connect_t *conn) {
+	io_service_t service = IOServiceGetMatchingService(0, IOServiceMatching("AppleSMC"));
+	if (!service) {
+		return kIOReturnNotFound;
+	}
+	kern_return_t ret = IOServiceOpen(service, mach_task_self(), 0, conn);
+	IOObjectRelease(service);
+	return ret;
+}
+
+static kern_return_t smcCall(io_connect_t conn, smcKeyData *in, smcKeyData *out) {
+	size_t outSize = sizeof(smcKeyData);
+	return IOConnectCallStructMethod(conn, SMC_KERNEL_INDEX, in, sizeof(smcKeyData), out, &outSize);
+}
+
+// smcRead reads the value of key into bytes, which must hold 32 bytes.
+static kern_return_t smcRead(io_connect_t conn, UInt32 key, UInt32 *type, UInt32 *size, unsigned char *bytes) {
+	smcKeyData in, out;
+	memset(&in, 0, sizeof(in));
+	memset(&out, 0, sizeof(out));
+	in.key = key;
+	in.data8 = SMC_CMD_READ_KEYINFO;
+	kern_return_t ret = smcCall(conn, &in, &out);
+	if (ret != kIOReturnSuccess) {
+		return ret;
+	}
+	if (out.result != 0) {
+		return kIOReturnNotFound;
+	}
+	*type = out.keyInfo.dataType;
+	*size = out.keyInfo.dataSize;
+
+	in.keyInfo.dataSize = out.keyInfo.dataSize;
+	in.data8 = SMC_CMD_READ_BYTES;
+	memset(&out, 0, sizeof(out));
+	ret = smcCall(conn, &in, &out);
+	if (ret != kIOReturnSuccess) {
+		return ret;
+	}
+	if (out.result != 0) {
+		return kIOReturnNotFound;
+	}
+	memcpy(bytes, out.bytes, sizeof(out.bytes));
+	return kIOReturnSuccess;
+}
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"unsafe"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// smcSupported tells whether the SMC can be read on this platform.
+const smcSupported = true
+
+// smcKey packs a four-character SMC key into its integer form.
+func smcKey(key string) C.UInt32 {
+	return C.UInt32(binary.BigEndian.Uint32([]byte(key)))
+}
+
+// smcRead returns the value of key, or false if the machine doesn't have it
+// or its type is not a numeric type we know.
+func smcRead(conn C.io_connect_t, key string) (float64, bool) {
+	var typ, size C.UInt32
+	var bytes [32]byte
+	if C.smcRead(conn, smcKey(key), &typ, &size, (*C.uchar)(unsafe.Pointer(&bytes[0]))) != C.kIOReturnSuccess {
+		return 0, false
+	}
+	var t [4]byte
+	binary.BigEndian.PutUint32(t[:], uint32(typ))
+	switch string(t[:]) {
+	case "sp78":
+		return float64(int16(binary.BigEndian.Uint16(bytes[:2]))) / 256, true
+	case "fpe2":
+		return float64(binary.BigEndian.Uint16(bytes[:2])) / 4, true
+	case "flt ":
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(bytes[:4]))), true
+	case "ui8 ":
+		return float64(bytes[0]), true
+	case "ui16":
+		return float64(binary.BigEndian.Uint16(bytes[:2])), true
+	}
+	return 0, false
+}
+
+func (s *SMCCollector) collect(ch chan<- prometheus.Metric) error {
+	var conn C.io_connect_t
+	if ret := C.smcOpen(&conn); ret != C.kIOReturnSuccess {
+		return fmt.Errorf("error opening AppleSMC: kern_return_t %#x", ret)
+	}
+	defer C.IOServiceClose(conn)
+
+	for key, name := range smcTemperatureKeys {
+		if value, ok := smcRead(conn, key); ok && value > 0 {
+			ch <- prometheus.MustNewConstMetric(smcTemperatureDesc,
+				prometheus.GaugeValue,
+				value,
+				name, "smc", "AppleSMC", "")
+		}
+	}
+
+	fans, _ := smcRead(conn, "FNum")
+	for i := 0; i < int(fans); i++ {
+		if value, ok := smcRead(conn, fmt.Sprintf("F%dAc", i)); ok {
+			ch <- prometheus.MustNewConstMetric(smcFanspeedDesc,
+				prometheus.GaugeValue,
+				value,
+				fmt.Sprintf("Fan %d", i), "smc", "AppleSMC", "")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !darwin || !cgo
+
+package main
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// smcSupported tells whether the SMC can be read on this platform.
+const smcSupported = false
+
+func (s *SMCCollector) collect(ch chan<- prometheus.Metric) error {
+	return errors.New("the SMC is only supported on macOS, in builds with cgo")
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sshSysfsScript is run by sh on remote hosts to dump the part of their sysfs
+// tree that the sysfs collectors read, each line one of:
+//
+//	D<tab>dir
+//	F<tab>file<tab>contents
+//	L<tab>link<tab>target
+//
+// with paths relative to /sys.  The entries of the classes read are dumped as
+// directories, holding the attribute files the collectors read and their
+// device link.  The device's subsystem link and block devices are dumped
+// under the device's own path, which the link points to.
+const sshSysfsScript = `cd /sys || exit 1
+for d in class/hwmon/* class/thermal/* class/power_supply/* class/powercap/*; do
+	[ -d "$d" ] || continue
+	printf 'D\t%s\n' "$d"
+	for f in "$d"/*; do
+		case ${f##*/} in
+		name|type|temp|*_input|*_label|pwm[0-9]*|max_state|cur_state|energy_uj|voltage_now|current_now|capacity)
+			[ -f "$f" ] && v=$(cat "$f" 2>/dev/null) && printf 'F\t%s\t%s\n' "$f" "$v"
+			;;
+		esac
+	done
+	[ -e "$d/device" ] || continue
+	t=$(readlink -f "$d/device") || continue
+	t=${t#/sys/}
+	printf 'L\t%s\t%s\n' "$d/device" "$t"
+	s=$(readlink -f "$t/subsystem") && printf 'L\t%s\t%s\n' "$t/subsystem" "${s#/sys/}"
+	for b in "$t"/block/*; do
+		[ -e "$b" ] && printf 'D\t%s\n' "$b"
+	done
+done
+`
+
+// sshSysfsMaxAge is how long a snapshot of a remote sysfs tree is reused, so
+// that the sysfs collectors share one SSH connection per scrape.
+const sshSysfsMaxAge = time.Second
+
+// sshSysfs is the sysfs tree of a remote host, read over SSH by running
+// sshSysfsScript with the ssh binary.  The host needs nothing but sh and
+// readlink, and the exporter's user an SSH key it accepts.
+type sshSysfs struct {
+	remote  string
+	ssh     string
+	timeout time.Duration
+
+	// run runs the script on the host, runSSH but in tests.
+	run func(ctx context.Context) ([]byte, error)
+
+	// mu guards the last snapshot, taken at takenAt, and the error taking
+	// it failed with.
+	mu       sync.Mutex
+	snapshot fs.FS
+	err      error
+	takenAt  time.Time
+}
+
+// newSSHSysfs returns the sysfs tree of remote, a host name or user@host as
+// given to ssh, read by running the ssh binary, which is killed if it takes
+// longer than timeout.
+func newSSHSysfs(remote, ssh string, timeout time.Duration) *sshSysfs {
+	s := &sshSysfs{
+		remote:  remote,
+		ssh:     ssh,
+		timeout: timeout,
+	}
+	s.run = s.runSSH
+	return s
+}
+
+func (s *sshSysfs) host() string {
+	return s.remote
+}
+
+// open returns the last snapshot of the tree, taking a new one if it is older
+// than sshSysfsMaxAge.  A host that can't be read fails every collector
+// reading it until the next attempt, sshSysfsMaxAge later.
+func (s *sshSysfs) open() (fs.FS, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.takenAt.IsZero() && time.Since(s.takenAt) < sshSysfsMaxAge {
+		return s.snapshot, s.err
+	}
+	ctx, cancel := collectContext(s.timeout)
+	defer cancel()
+	s.snapshot, s.err = nil, nil
+	out, err := s.run(ctx)
+	if err == nil {
+		s.snapshot, err = parseSysfsDump(out)
+	}
+	if err != nil {
+		s.err = fmt.Errorf("error reading sysfs of %s: %v", s.remote, err)
+	}
+	s.takenAt = time.Now()
+	return s.snapshot, s.err
+}
+
+func (s *sshSysfs) runSSH(ctx context.Context) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, s.ssh, "-o", "BatchMode=yes", "--", s.remote, "sh", "-s")
+	cmd.Stdin = strings.NewReader(sshSysfsScript)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// parseSysfsDump returns the tree dumped by sshSysfsScript.
+func parseSysfsDump(out []byte) (fs.FS, error) {
+	tree := &sysfsDump{
+		files: make(map[string][]byte),
+		links: make(map[string]string),
+		dirs:  map[string]map[string]bool{".": {}},
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		kind, rest, _ := strings.Cut(line, "\t")
+		name, value, _ := strings.Cut(rest, "\t")
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("unexpected line in sysfs dump: %q", line)
+		}
+		switch kind {
+		case "D":
+			tree.add(name)
+			if tree.dirs[name] == nil {
+				tree.dirs[name] = make(map[string]bool)
+			}
+		case "F":
+			tree.add(name)
+			tree.files[name] = []byte(value + "\n")
+		case "L":
+			if !fs.ValidPath(value) {
+				return nil, fmt.Errorf("unexpected line in sysfs dump: %q", line)
+			}
+			tree.add(name)
+			tree.links[name] = value
+		default:
+			return nil, fmt.Errorf("unexpected line in sysfs dump: %q", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// sysfsDump is a tree dumped by sshSysfsScript, held in memory.  Its links
+// hold their target relative to the root, resolved by readlink -f, so that
+// the targets hold no links themselves.  Directories are implied by the
+// entries they hold.
+type sysfsDump struct {
+	files map[string][]byte
+	links map[string]string
+	// dirs holds the names of the entries of each directory.
+	dirs map[string]map[string]bool
+}
+
+// add adds name to its directory, and the directories above it to theirs.
+func (d *sysfsDump) add(name string) {
+	for name != "." {
+		dir := path.Dir(name)
+		if d.dirs[dir] == nil {
+			d.dirs[dir] = make(map[string]bool)
+		}
+		d.dirs[dir][path.Base(name)] = true
+		name = dir
+	}
+}
+
+// resolve returns the path name refers to once its links are followed, but
+// for the last element unless last is set.
+func (d *sysfsDump) resolve(op, name string, last bool) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	resolved := "."
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		resolved = path.Join(resolved, elem)
+		if target, ok := d.links[resolved]; ok && (last || i < len(elems)-1) {
+			resolved = target
+		}
+	}
+	return resolved, nil
+}
+
+// info describes the entry at the resolved path p, named name.
+func (d *sysfsDump) info(op, name, p string) (fs.FileInfo, error) {
+	base := path.Base(name)
+	if data, ok := d.files[p]; ok {
+		return sysfsDumpInfo{name: base, size: int64(len(data)), mode: 0o444}, nil
+	}
+	if _, ok := d.dirs[p]; ok {
+		return sysfsDumpInfo{name: base, mode: fs.ModeDir | 0o555}, nil
+	}
+	if _, ok := d.links[p]; ok {
+		return sysfsDumpInfo{name: base, mode: fs.ModeSymlink | 0o777}, nil
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// Open implements fs.FS.
+func (d *sysfsDump) Open(name string) (fs.File, error) {
+	p, err := d.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info, err := d.info("open", name, p)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, _ := d.ReadDir(name)
+		return &sysfsDumpDir{info: info, entries: entries}, nil
+	}
+	return &sysfsDumpFile{info: info, Reader: bytes.NewReader(d.files[p])}, nil
+}
+
+// Stat implements fs.StatFS.
+func (d *sysfsDump) Stat(name string) (fs.FileInfo, error) {
+	p, err := d.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return d.info("stat", name, p)
+}
+
+// Lstat implements fs.ReadLinkFS.
+func (d *sysfsDump) Lstat(name string) (fs.FileInfo, error) {
+	p, err := d.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return d.info("lstat", name, p)
+}
+
+// ReadLink implements fs.ReadLinkFS.  It returns the target relative to the
+// link's directory, as sysfs links are.
+func (d *sysfsDump) ReadLink(name string) (string, error) {
+	p, err := d.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	target, ok := d.links[p]
+	if !ok {
+		if _, err := d.info("readlink", name, p); err != nil {
+			return "", err
+		}
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	rel, err := filepath.Rel(path.Dir(p), target)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (d *sysfsDump) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := d.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	children, ok := d.dirs[p]
+	if !ok {
+		if _, err := d.info("readdir", name, p); err != nil {
+			return nil, err
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries := make([]fs.DirEntry, 0, len(children))
+	for child := range children {
+		info, err := d.info("readdir", child, path.Join(p, child))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (d *sysfsDump) ReadFile(name string) ([]byte, error) {
+	p, err := d.resolve("read", name, true)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := d.files[p]
+	if !ok {
+		if _, err := d.info("read", name, p); err != nil {
+			return nil, err
+		}
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	return bytes.Clone(data), nil
+}
+
+// sysfsDumpInfo describes an entry of a sysfsDump.
+type sysfsDumpInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func (i sysfsDumpInfo) Name() string       { return i.name }
+func (i sysfsDumpInfo) Size() int64        { return i.size }
+func (i sysfsDumpInfo) Mode() fs.FileMode  { return i.mode }
+func (i sysfsDumpInfo) ModTime() time.Time { return time.Time{} }
+func (i sysfsDumpInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i sysfsDumpInfo) Sys() any           { return nil }
+
+// sysfsDumpFile is a file of a sysfsDump, opened.
+type sysfsDumpFile struct {
+	info fs.FileInfo
+	*bytes.Reader
+}
+
+func (f *sysfsDumpFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *sysfsDumpFile) Close() error               { return nil }
+
+// sysfsDumpDir is a directory of a sysfsDump, opened.
+type sysfsDumpDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (d *sysfsDumpDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *sysfsDumpDir) Close() error               { return nil }
+
+func (d *sysfsDumpDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *sysfsDumpDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// writeSysfs lays out a sysfs tree under root, with the class entries and
+// device links symlinks as in the kernel's.
+func writeSysfs(t *testing.T, root string) {
+	t.Helper()
+	files := map[string]string{
+		"devices/pci0000:00/0000:00:18.3/hwmon/hwmon0/name":          "k10temp",
+		"devices/pci0000:00/0000:00:18.3/hwmon/hwmon0/temp1_input":   "45125",
+		"devices/pci0000:00/0000:00:18.3/hwmon/hwmon0/temp1_label":   "Tctl",
+		"devices/pci0000:00/0000:00:18.3/hwmon/hwmon0/temp1_max":     "70000",
+		"devices/pci0000:00/0000:00:18.3/hwmon/hwmon0/pwm1":          "128",
+		"devices/platform/nct6775.656/hwmon/hwmon1/name":             "nct6775",
+		"devices/platform/nct6775.656/hwmon/hwmon1/in0_input":        "1010",
+		"devices/platform/nct6775.656/hwmon/hwmon1/fan2_input":       "1200",
+		"devices/ata1/0:0:0:0/hwmon/hwmon2/name":                     "drivetemp",
+		"devices/ata1/0:0:0:0/hwmon/hwmon2/temp1_input":              "35000",
+		"devices/virtual/thermal/thermal_zone0/temp":                 "40000",
+		"devices/virtual/thermal/thermal_zone0/type":                 "acpitz",
+		"devices/virtual/thermal/cooling_device0/type":               "Processor",
+		"devices/virtual/thermal/cooling_device0/max_state":          "3",
+		"devices/virtual/thermal/cooling_device0/cur_state":          "1",
+		"devices/LNXSYSTM:00/PNP0C0A:00/power_supply/BAT0/type":      "Battery",
+		"devices/LNXSYSTM:00/PNP0C0A:00/power_supply/BAT0/capacity":  "80",
+		"devices/virtual/powercap/intel-rapl/intel-rapl:0/name":      "package-0",
+		"devices/virtual/powercap/intel-rapl/intel-rapl:0/energy_uj": "123456789",
+	}
+	dirs := []string{"bus/pci", "bus/platform", "bus/scsi", "devices/ata1/0:0:0:0/block/sda"}
+	links := map[string]string{
+		"class/hwmon/hwmon0":            "../../devices/pci0000:00/0000:00:18.3/hwmon/hwmon0",
+		"class/hwmon/hwmon1":            "../../devices/platform/nct6775.656/hwmon/hwmon1",
+		"class/hwmon/hwmon2":            "../../devices/ata1/0:0:0:0/hwmon/hwmon2",
+		"class/thermal/thermal_zone0":   "../../devices/virtual/thermal/thermal_zone0",
+		"class/thermal/cooling_device0": "../../devices/virtual/thermal/cooling_device0",
+		"class/power_supply/BAT0":       "../../devices/LNXSYSTM:00/PNP0C0A:00/power_supply/BAT0",
+		"class/powercap/intel-rapl:0":   "../../devices/virtual/powercap/intel-rapl/intel-rapl:0",
+
+		"devices/pci0000:00/0000:00:18.3/hwmon/hwmon0/device": "../../../0000:00:18.3",
+		"devices/pci0000:00/0000:00:18.3/subsystem":           "../../../bus/pci",
+		"devices/platform/nct6775.656/hwmon/hwmon1/device":    "../../../nct6775.656",
+		"devices/platform/nct6775.656/subsystem":              "../../../bus/platform",
+		"devices/ata1/0:0:0:0/hwmon/hwmon2/device":            "../../../0:0:0:0",
+		"devices/ata1/0:0:0:0/subsystem":                      "../../../bus/scsi",
+	}
+	for name, contents := range files {
+		name = filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(contents+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, target := range links {
+		name = filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// sysfsCollectors returns every sysfs collector reading sysfs.
+func sysfsCollectors(sysfs sysfsTree) []prometheus.Collector {
+	return []prometheus.Collector{
+		NewHwmonCollector(sysfs),
+		NewThermalZoneCollector(sysfs),
+		NewCoolingDeviceCollector(sysfs),
+		NewDrivetempCollector(sysfs),
+		NewPowerSupplyCollector(sysfs),
+		NewRaplCollector(sysfs),
+	}
+}
+
+// sysfsSeries returns the series the collectors serve, but for their scrape
+// status, as sorted strings.
+func sysfsSeries(t *testing.T, collectors []prometheus.Collector) []string {
+	t.Helper()
+	var series []string
+	for _, c := range collectors {
+		for name, mf := range gather(t, c) {
+			if _, ok := scrapeStatusFamilies[name]; ok {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				var labels []string
+				for _, lp := range m.GetLabel() {
+					labels = append(labels, lp.GetName()+"="+lp.GetValue())
+				}
+				value := m.GetGauge().GetValue() + m.GetCounter().GetValue()
+				series = append(series, fmt.Sprintf("%s{%s} %v", name, strings.Join(labels, ","), value))
+			}
+		}
+	}
+	sort.Strings(series)
+	return series
+}
+
+func TestSSHSysfsMatchesLocal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	if _, err := exec.LookPath("readlink"); err != nil {
+		t.Skip("needs readlink")
+	}
+	dir := t.TempDir()
+	root := filepath.Join(dir, "sys")
+	writeSysfs(t, root)
+	// The fake ssh runs the script on this host, on the tree under root
+	// rather than /sys.
+	ssh := filepath.Join(dir, "ssh")
+	script := "#!/bin/sh\nsed 's|/sys|" + root + "|g' | sh -s\n"
+	if err := os.WriteFile(ssh, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	local := sysfsSeries(t, sysfsCollectors(newLocalSysfs(root)))
+	remote := sysfsSeries(t, sysfsCollectors(newSSHSysfs("node1", ssh, 10*time.Second)))
+	if !reflect.DeepEqual(remote, local) {
+		t.Errorf("read over SSH:\n%s\nread locally:\n%s", strings.Join(remote, "\n"), strings.Join(local, "\n"))
+	}
+	for _, want := range []string{
+		"sensor_lm_temperature_celsius{adaptor=pci,chip=k10temp-0000:00:18.3,device=0000:00:18.3,source=hwmon,temptype=Tctl} 45.125",
+		"sensor_lm_fan_speed_rpm{adaptor=platform,chip=nct6775-nct6775.656,device=nct6775.656,fantype=fan2,source=hwmon} 1200",
+		"sensor_disk_temperature_celsius{device=sda} 35",
+		"sensor_thermal_zone_temperature_celsius{type=acpitz,zone=0} 40",
+		"sensor_cooling_device_state_ratio{device=0,type=Processor} 0.3333333333333333",
+		"sensor_power_supply_capacity_ratio{supply=BAT0,type=Battery} 0.8",
+		"sensor_rapl_energy_joules_total{name=package-0,zone=0} 123.456789",
+	} {
+		found := false
+		for _, s := range local {
+			found = found || s == want
+		}
+		if !found {
+			t.Errorf("%s not served, got:\n%s", want, strings.Join(local, "\n"))
+		}
+	}
+}
+
+func TestSSHSysfsUnreachable(t *testing.T) {
+	sysfs := newSSHSysfs("down", "ssh", time.Second)
+	runs := 0
+	sysfs.run = func(ctx context.Context) ([]byte, error) {
+		runs++
+		return nil, errors.New("ssh: connect to host down port 22: Connection refused")
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(prometheus.WrapCollectorWith(prometheus.Labels{"host": "down"}, collectorList(sysfsCollectors(sysfs))))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := 0
+	for _, mf := range mfs {
+		if mf.GetName() != "sensor_scrape_success" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if v := m.GetGauge().GetValue(); v != 0 {
+				t.Errorf("sensor_scrape_success = %v for %v, want 0", v, m.GetLabel())
+			}
+			failed++
+		}
+	}
+	if failed != 6 {
+		t.Errorf("%d collectors reported failing, want 6", failed)
+	}
+	if runs != 1 {
+		t.Errorf("ssh run %d times for one scrape, want once", runs)
+	}
+}
+
+// collectorList is a collector made of several.
+type collectorList []prometheus.Collector
+
+func (l collectorList) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range l {
+		c.Describe(ch)
+	}
+}
+
+func (l collectorList) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range l {
+		c.Collect(ch)
+	}
+}
+
+func TestParseSysfsDumpRejectsBadLines(t *testing.T) {
+	for _, line := range []string{
+		"X\tclass/hwmon",
+		"F\t/etc/passwd\troot",
+		"F\t../etc/passwd\troot",
+		"L\tclass/hwmon/hwmon0/device\t../outside",
+		"D\t",
+	} {
+		if _, err := parseSysfsDump([]byte(line + "\n")); err == nil {
+			t.Errorf("no error for %q", line)
+		}
+	}
+}
+
+func TestSysfsDumpFS(t *testing.T) {
+	tree, err := parseSysfsDump([]byte("D\tclass/hwmon/hwmon0\n" +
+		"F\tclass/hwmon/hwmon0/name\tk10temp\n" +
+		"F\tclass/hwmon/hwmon0/temp1_input\t45125\n" +
+		"L\tclass/hwmon/hwmon0/device\tdevices/pci0000:00/0000:00:18.3\n" +
+		"L\tdevices/pci0000:00/0000:00:18.3/subsystem\tbus/pci\n" +
+		"D\tdevices/pci0000:00/0000:00:18.3/block/sda\n" +
+		"D\tbus/pci\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(tree, "class/hwmon/hwmon0/name", "devices/pci0000:00/0000:00:18.3/block/sda"); err != nil {
+		t.Error(err)
+	}
+	if got, err := fs.ReadLink(tree, "class/hwmon/hwmon0/device/subsystem"); err != nil || got != "../../../bus/pci" {
+		t.Errorf("ReadLink(device/subsystem) = %q, %v, want ../../../bus/pci", got, err)
+	}
+	if got, err := readSysfsString(tree, "class/hwmon/hwmon0/name"); err != nil || got != "k10temp" {
+		t.Errorf("name = %q, %v, want k10temp", got, err)
+	}
+	if entries, err := fs.ReadDir(tree, "class/hwmon/hwmon0/device/block"); err != nil || len(entries) != 1 || entries[0].Name() != "sda" {
+		t.Errorf("ReadDir(device/block) = %v, %v, want sda", entries, err)
+	}
+	if _, err := fs.ReadFile(tree, "class/hwmon/hwmon0/temp2_input"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile(temp2_input) = %v, want fs.ErrNotExist", err)
+	}
+}
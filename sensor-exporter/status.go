@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	exporterUpDesc = prometheus.NewDesc(
+		"sensor_exporter_up",
+		"1 if the last scrape of every collector succeeded, 0 otherwise",
+		nil,
+		nil)
+
+	exporterLastErrorDesc = prometheus.NewDesc(
+		"sensor_exporter_last_scrape_error",
+		"1 for the collector that failed most recently, present only while a collector is failing; the error is logged",
+		[]string{"collector", "source"},
+		nil)
+
+	exporterStartTimeDesc = prometheus.NewDesc(
+		"sensor_exporter_start_time_seconds",
+		"time the exporter started, in seconds since the Unix epoch",
+		nil,
+		nil)
+
+	// startTime is set as the process initializes the package, before
+	// main runs.
+	startTime = time.Now()
+
+	// scrapeDurations complements the sensor_scrape_duration_seconds
+	// gauges, which only show the last scrape, for latency percentiles.
+	// It is registered with the exporter status.
+	scrapeDurations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sensor_collector_duration_seconds",
+		Help:    "duration of the scrapes of the collector in seconds",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"collector", "source"})
+)
+
+// scrapeStatus reports whether a collector's last scrape succeeded and how
+// long it took.
+type scrapeStatus struct {
+	collector    string
+	source       string
+	successDesc  *prometheus.Desc
+	durationDesc *prometheus.Desc
+}
+
+func newScrapeStatus(collector, source string) scrapeStatus {
+	scrapeResults.expect(collector, source)
+	labels := prometheus.Labels{"collector": collector, "source": source}
+	return scrapeStatus{
+		collector: collector,
+		source:    source,
+		successDesc: prometheus.NewDesc(
+			"sensor_scrape_success",
+			"1 if the last scrape of the collector succeeded, 0 otherwise",
+			nil,
+			labels),
+		durationDesc: prometheus.NewDesc(
+			"sensor_scrape_duration_seconds",
+			"duration of the last scrape of the collector in seconds",
+			nil,
+			labels),
+	}
+}
+
+func (s scrapeStatus) describe(ch chan<- *prometheus.Desc) {
+	ch <- s.successDesc
+	ch <- s.durationDesc
+}
+
+func (s scrapeStatus) collect(ch chan<- prometheus.Metric, begin time.Time, err error) {
+	s.send(ch, begin, err)
+	scrapeResults.record(s.collector, s.source, begin, err)
+}
+
+// collectTimeout reports the scrape that began at begin as failed with err
+// when it timed out, discarding what the collector records for it later.
+func (s scrapeStatus) collectTimeout(ch chan<- prometheus.Metric, begin time.Time, err error) {
+	scrapeResults.timeout(s.collector, s.source, err)
+	s.send(ch, begin, err)
+}
+
+func (s scrapeStatus) send(ch chan<- prometheus.Metric, begin time.Time, err error) {
+	success := 1.0
+	if err != nil {
+		success = 0
+	}
+	ch <- prometheus.MustNewConstMetric(s.successDesc, prometheus.GaugeValue, success)
+	duration := time.Since(begin).Seconds()
+	ch <- prometheus.MustNewConstMetric(s.durationDesc, prometheus.GaugeValue, duration)
+	scrapeDurations.WithLabelValues(s.collector, s.source).Observe(duration)
+}
+
+type scrapeResult struct {
+	collector string
+	source    string
+	err       error
+	at        time.Time
+	// succeeded is true once any scrape of the collector has succeeded.
+	succeeded bool
+}
+
+// scrapeResultTracker remembers the outcome of the last scrape of every
+// collector, for the exporter-wide status.
+type scrapeResultTracker struct {
+	mu      sync.Mutex
+	results map[[2]string]scrapeResult
+	// timedOut is the time the last scrape of a collector that timed out
+	// was recorded at.  The results of the scrapes that began before are
+	// late and discarded.
+	timedOut map[[2]string]time.Time
+}
+
+var scrapeResults = &scrapeResultTracker{
+	results:  make(map[[2]string]scrapeResult),
+	timedOut: make(map[[2]string]time.Time),
+}
+
+// expect adds a collector that has not been scraped yet, so that readiness
+// waits for it.
+func (t *scrapeResultTracker) expect(collector, source string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.results[[2]string{collector, source}] = scrapeResult{collector: collector, source: source}
+}
+
+// record sets the outcome of a scrape of the collector that began at begin,
+// unless the scrape timed out and its outcome was already recorded.
+func (t *scrapeResultTracker) record(collector, source string, begin time.Time, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := [2]string{collector, source}
+	if begin.Before(t.timedOut[key]) {
+		return
+	}
+	t.set(key, err)
+}
+
+// timeout records that a scrape of the collector timed out with err.
+func (t *scrapeResultTracker) timeout(collector, source string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := [2]string{collector, source}
+	t.set(key, err)
+	t.timedOut[key] = t.results[key].at
+}
+
+// set records err as the result of the last scrape of the collector.  The
+// caller holds t.mu.
+func (t *scrapeResultTracker) set(key [2]string, err error) {
+	collector, source := key[0], key[1]
+	t.results[key] = scrapeResult{
+		collector: collector,
+		source:    source,
+		err:       err,
+		at:        time.Now(),
+		succeeded: t.results[key].succeeded || err == nil,
+	}
+}
+
+// snapshot returns the last result of every collector.
+func (t *scrapeResultTracker) snapshot() []scrapeResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	results := make([]scrapeResult, 0, len(t.results))
+	for _, r := range t.results {
+		results = append(results, r)
+	}
+	return results
+}
+
+// status describes the result for humans.
+func (r scrapeResult) status() string {
+	switch {
+	case r.at.IsZero():
+		return "not scraped yet"
+	case r.err != nil:
+		return "failing: " + r.err.Error()
+	}
+	return "ok"
+}
+
+// ready reports whether every collector has succeeded at least once and not
+// all of them failed their last scrape.  Otherwise the reason is returned.
+func (t *scrapeResultTracker) ready() (bool, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	failing := 0
+	for _, r := range t.results {
+		if !r.succeeded {
+			return false, fmt.Sprintf("collector %s has not succeeded yet", describeCollector(r.collector, r.source))
+		}
+		if r.err != nil {
+			failing++
+		}
+	}
+	if len(t.results) > 0 && failing == len(t.results) {
+		return false, "all collectors failed their last scrape"
+	}
+	return true, ""
+}
+
+func describeCollector(collector, source string) string {
+	if source == "" {
+		return collector
+	}
+	return collector + " (" + source + ")"
+}
+
+// lastError returns the most recent of the collectors' last results that is
+// an error, if any.
+func (t *scrapeResultTracker) lastError() (scrapeResult, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var last scrapeResult
+	found := false
+	for _, r := range t.results {
+		if r.err != nil && (!found || r.at.After(last.at)) {
+			last, found = r, true
+		}
+	}
+	return last, found
+}
+
+// ExporterStatusCollector summarizes the scrape status of all collectors.  It
+// must be gathered after them.
+type ExporterStatusCollector struct{}
+
+func NewExporterStatusCollector() *ExporterStatusCollector {
+	return &ExporterStatusCollector{}
+}
+
+// Describe implements prometheus.Collector.
+func (e *ExporterStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- exporterUpDesc
+	ch <- exporterLastErrorDesc
+	ch <- exporterStartTimeDesc
+}
+
+// Collect implements prometheus.Collector.
+func (e *ExporterStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	last, failing := scrapeResults.lastError()
+	up := 1.0
+	if failing {
+		up = 0
+		ch <- prometheus.MustNewConstMetric(exporterLastErrorDesc,
+			prometheus.GaugeValue,
+			1,
+			last.collector, last.source)
+	}
+	ch <- prometheus.MustNewConstMetric(exporterUpDesc, prometheus.GaugeValue, up)
+	ch <- prometheus.MustNewConstMetric(exporterStartTimeDesc,
+		prometheus.GaugeValue,
+		float64(startTime.UnixNano())/1e9)
+}
+
+// healthyHandler serves /-/healthy, which succeeds as long as the process runs.
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "Sensor Exporter is Healthy.")
+}
+
+// readyHandler serves /-/ready, which fails until every enabled collector has
+// been scraped successfully, and whenever all of them are failing.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if ok, reason := scrapeResults.ready(); !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "Sensor Exporter is not ready: %s.\n", reason)
+		return
+	}
+	fmt.Fprintln(w, "Sensor Exporter is Ready.")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExporterLastScrapeError(t *testing.T) {
+	for _, msg := range []string{"timed out after 734ms", "timed out after 812ms"} {
+		scrapeResults.record("failing", "node1", time.Now(), errors.New(msg))
+		mf, ok := gather(t, NewExporterStatusCollector())["sensor_exporter_last_scrape_error"]
+		if !ok {
+			t.Fatalf("sensor_exporter_last_scrape_error not served for %q", msg)
+		}
+		got := map[string]string{}
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				got[lp.GetName()] = lp.GetValue()
+			}
+		}
+		if want := map[string]string{"collector": "failing", "source": "node1"}; len(mf.GetMetric()) != 1 || !reflect.DeepEqual(got, want) {
+			t.Errorf("sensor_exporter_last_scrape_error labels = %v for %q, want one series labeled %v", got, msg, want)
+		}
+	}
+	scrapeResults.record("failing", "node1", time.Now(), nil)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sysfsTree is the sysfs tree the sysfs collectors read: the one mounted on
+// this host, or one read from a remote host by sshSysfs.
+type sysfsTree interface {
+	// host names the host the tree belongs to, "" for this one.  It is
+	// the source of the scrape status of the collectors reading it.
+	host() string
+	// open returns the tree to read for a scrape, with paths such as
+	// "class/hwmon/hwmon0/name".
+	open() (fs.FS, error)
+}
+
+// localSysfs is a sysfs tree of this host.
+type localSysfs struct {
+	fsys fs.FS
+}
+
+// newLocalSysfs returns the sysfs tree mounted at path.
+func newLocalSysfs(path string) localSysfs {
+	return localSysfs{fsys: os.DirFS(path)}
+}
+
+func (l localSysfs) host() string {
+	return ""
+}
+
+func (l localSysfs) open() (fs.FS, error) {
+	return l.fsys, nil
+}
+
+// hostRoot is the root of this host's filesystem, for the sysfs paths
+// libsensors reports, such as /sys/class/hwmon/hwmon0, relative to it.
+var hostRoot = os.DirFS("/")
+
+// readSysfsString returns the contents of a sysfs attribute file without the
+// trailing newline.
+func readSysfsString(fsys fs.FS, name string) (string, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readSysfsInt returns the integer held by a sysfs attribute file.
+func readSysfsInt(fsys fs.FS, name string) (int64, error) {
+	s, err := readSysfsString(fsys, name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
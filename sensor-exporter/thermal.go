@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/fs"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var thermalZoneTempDesc = prometheus.NewDesc(
+	"sensor_thermal_zone_temperature_celsius",
+	"thermal zone temperature in celsius",
+	[]string{"zone", "type"},
+	nil)
+
+// ThermalZoneCollector exports the kernel's thermal zones, which are often the
+// only temperature sensors on ARM boards and VMs without lm-sensors chips.
+type ThermalZoneCollector struct {
+	sysfs  sysfsTree
+	status scrapeStatus
+}
+
+// NewThermalZoneCollector returns a collector reading the thermal zones of
+// sysfs.
+func NewThermalZoneCollector(sysfs sysfsTree) *ThermalZoneCollector {
+	return &ThermalZoneCollector{
+		sysfs:  sysfs,
+		status: newScrapeStatus("thermal_zone", sysfs.host()),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (t *ThermalZoneCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- thermalZoneTempDesc
+	t.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (t *ThermalZoneCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := t.collect(ch)
+	if err != nil {
+		slog.Error("error reading thermal zones", "err", err)
+	}
+	t.status.collect(ch, begin, err)
+}
+
+func (t *ThermalZoneCollector) collect(ch chan<- prometheus.Metric) error {
+	fsys, err := t.sysfs.open()
+	if err != nil {
+		return err
+	}
+	dirs, err := fs.Glob(fsys, "class/thermal/thermal_zone*")
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		millidegrees, err := readSysfsInt(fsys, path.Join(dir, "temp"))
+		if err != nil {
+			slog.Debug("skipping thermal zone", "path", dir, "err", err)
+			continue
+		}
+		zoneType, err := readSysfsString(fsys, path.Join(dir, "type"))
+		if err != nil {
+			slog.Debug("skipping thermal zone", "path", dir, "err", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(thermalZoneTempDesc,
+			prometheus.GaugeValue,
+			float64(millidegrees)/1000,
+			strings.TrimPrefix(path.Base(dir), "thermal_zone"), zoneType)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// timeoutCollector bounds how long the collector it wraps may take to
+// collect.  When the timeout expires, the metrics collected so far are kept,
+// the collector's scrape is reported as failed, and the rest of its metrics
+// and its own scrape status are dropped once it finishes.  A collector that
+// already sent its scrape status is done reading its source and is let finish,
+// since its status can't be reported twice.  Collectors running commands kill
+// them at the timeout through collectContext.
+type timeoutCollector struct {
+	prometheus.Collector
+	status  scrapeStatus
+	timeout time.Duration
+}
+
+// withTimeout wraps c, whose scrape status is reported through status, in a
+// timeoutCollector.  c is returned as is if timeout is 0.
+func withTimeout(c prometheus.Collector, status scrapeStatus, timeout time.Duration) prometheus.Collector {
+	if timeout == 0 {
+		return c
+	}
+	return &timeoutCollector{Collector: c, status: status, timeout: timeout}
+}
+
+// Collect implements prometheus.Collector.
+func (t *timeoutCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		t.Collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+	expired := timer.C
+	for {
+		select {
+		case m, ok := <-metrics:
+			if !ok {
+				return
+			}
+			ch <- m
+			if m.Desc() == t.status.successDesc {
+				expired = nil
+			}
+		case <-expired:
+			err := fmt.Errorf("timed out after %v", t.timeout)
+			slog.Error("collector timed out", "collector", t.status.collector, "source", t.status.source, "timeout", t.timeout)
+			t.status.collectTimeout(ch, begin, err)
+			// Let the collector run to completion in the background.
+			go func() {
+				for range metrics {
+				}
+			}()
+			return
+		}
+	}
+}
+
+// collectContext returns the context of a scrape that may take no longer
+// than timeout, or no deadline if timeout is 0.
+func collectContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// slowCollector succeeds once release is closed.
+type slowCollector struct {
+	status  scrapeStatus
+	release chan struct{}
+	done    chan struct{}
+}
+
+func (s *slowCollector) Describe(ch chan<- *prometheus.Desc) {
+	s.status.describe(ch)
+}
+
+func (s *slowCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	<-s.release
+	s.status.collect(ch, begin, nil)
+	s.done <- struct{}{}
+}
+
+// lastResult returns the result the tracker holds for the collector.
+func lastResult(t *testing.T, collector string) scrapeResult {
+	t.Helper()
+	for _, r := range scrapeResults.snapshot() {
+		if r.collector == collector {
+			return r
+		}
+	}
+	t.Fatalf("no result for collector %s", collector)
+	return scrapeResult{}
+}
+
+func TestTimeoutDiscardsLateResult(t *testing.T) {
+	slow := &slowCollector{
+		status:  newScrapeStatus("slow", ""),
+		release: make(chan struct{}),
+		done:    make(chan struct{}, 1),
+	}
+	c := withTimeout(slow, slow.status, 20*time.Millisecond)
+
+	families := gather(t, c)
+	if got := metricValues(families["sensor_scrape_success"], "")[""]; got != 0 {
+		t.Errorf("sensor_scrape_success = %v for a scrape that timed out, want 0", got)
+	}
+	close(slow.release)
+	<-slow.done
+	if r := lastResult(t, "slow"); r.err == nil {
+		t.Error("late success recorded over the timeout")
+	}
+
+	// The next scrape is on time.
+	families = gather(t, c)
+	<-slow.done
+	if got := metricValues(families["sensor_scrape_success"], "")[""]; got != 1 {
+		t.Errorf("sensor_scrape_success = %v, want 1", got)
+	}
+	if r := lastResult(t, "slow"); r.err != nil {
+		t.Errorf("scrape on time recorded as %v", r.err)
+	}
+}
+
+// statusFirstCollector sends its scrape status, then blocks until release is
+// closed.
+type statusFirstCollector struct {
+	status  scrapeStatus
+	release chan struct{}
+}
+
+func (s *statusFirstCollector) Describe(ch chan<- *prometheus.Desc) {
+	s.status.describe(ch)
+}
+
+func (s *statusFirstCollector) Collect(ch chan<- prometheus.Metric) {
+	s.status.collect(ch, time.Now(), nil)
+	<-s.release
+}
+
+func TestTimeoutAfterStatusSent(t *testing.T) {
+	slow := &statusFirstCollector{
+		status:  newScrapeStatus("status_first", ""),
+		release: make(chan struct{}),
+	}
+	c := withTimeout(slow, slow.status, 20*time.Millisecond)
+	time.AfterFunc(100*time.Millisecond, func() { close(slow.release) })
+
+	// gather fails on the status being sent twice.
+	families := gather(t, c)
+	if got := metricValues(families["sensor_scrape_success"], "")[""]; got != 1 {
+		t.Errorf("sensor_scrape_success = %v, want 1", got)
+	}
+}
+
+func TestCommandKilledAtTimeout(t *testing.T) {
+	hang := filepath.Join(t.TempDir(), "hang")
+	if err := os.WriteFile(hang, []byte("#!/bin/sh\nexec sleep 60\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	const timeout = 50 * time.Millisecond
+	for name, c := range map[string]interface {
+		collect(chan<- prometheus.Metric) error
+	}{
+		"nvme":    NewNvmeCollector(hang, []string{"/dev/nvme0"}, "", timeout),
+		"ipmi":    NewIpmiCollector(hang, timeout),
+		"gpu":     NewGpuCollector(hang, timeout),
+		"rpi":     NewRpiCollector(hang, timeout),
+		"lm_json": NewLmJSONCollector(hang, nil, nil, nil, timeout),
+	} {
+		begin := time.Now()
+		err := c.collect(make(chan prometheus.Metric, 100))
+		if err == nil {
+			t.Errorf("%s: no error for a command killed at the timeout", name)
+		}
+		if took := time.Since(begin); took > 10*time.Second {
+			t.Errorf("%s: took %v with a timeout of %v", name, took, timeout)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// temperatureUnits maps the -temperature.unit values to the conversion from
+// celsius.  Celsius, the Prometheus base unit, needs no conversion.
+var temperatureUnits = map[string]func(float64) float64{
+	"celsius":    nil,
+	"fahrenheit": func(c float64) float64 { return c*9/5 + 32 },
+	"kelvin":     func(c float64) float64 { return c + 273.15 },
+}
+
+// unitGatherer adds, to the families gathered from a Gatherer, a copy of each
+// *_celsius gauge family converted to another unit and renamed after it,
+// such as *_fahrenheit.  The celsius families are served unchanged, so that
+// every temperature source is converted the same way in one place.
+type unitGatherer struct {
+	gatherer prometheus.Gatherer
+	unit     string
+	convert  func(float64) float64
+}
+
+// newUnitGatherer returns g itself for celsius.  unit must be a key of
+// temperatureUnits.
+func newUnitGatherer(g prometheus.Gatherer, unit string) prometheus.Gatherer {
+	if temperatureUnits[unit] == nil {
+		return g
+	}
+	return &unitGatherer{gatherer: g, unit: unit, convert: temperatureUnits[unit]}
+}
+
+// Gather implements prometheus.Gatherer.
+func (u *unitGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := u.gatherer.Gather()
+	for _, mf := range mfs {
+		name, ok := strings.CutSuffix(mf.GetName(), "_celsius")
+		if !ok || mf.GetType() != dto.MetricType_GAUGE {
+			continue
+		}
+		converted := &dto.MetricFamily{
+			Name: proto.String(name + "_" + u.unit),
+			Help: proto.String(strings.ReplaceAll(mf.GetHelp(), "celsius", u.unit)),
+			Type: mf.Type,
+		}
+		for _, m := range mf.GetMetric() {
+			c := proto.Clone(m).(*dto.Metric)
+			c.Gauge.Value = proto.Float64(u.convert(m.GetGauge().GetValue()))
+			converted.Metric = append(converted.Metric, c)
+		}
+		mfs = append(mfs, converted)
+	}
+	return mfs, err
+}
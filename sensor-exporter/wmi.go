@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// wmiSensorDescs maps the OpenHardwareMonitor sensor types to the metric they
+// are exported as.  Sensors of other types are ignored.
+var wmiSensorDescs = map[string]*prometheus.Desc{
+	"Fan":         newFanspeedDesc("wmi"),
+	"Temperature": newTemperatureDesc("wmi"),
+	"Voltage":     newVoltageDesc("wmi"),
+}
+
+// WmiCollector exports the sensors OpenHardwareMonitor publishes in the
+// root\OpenHardwareMonitor WMI namespace on Windows, in the lm-sensors
+// families with source="wmi".
+type WmiCollector struct {
+	status scrapeStatus
+}
+
+func NewWmiCollector() *WmiCollector {
+	return &WmiCollector{status: newScrapeStatus("wmi", "")}
+}
+
+// Describe implements prometheus.Collector.
+func (w *WmiCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range wmiSensorDescs {
+		ch <- desc
+	}
+	w.status.describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (w *WmiCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	err := w.collect(ch)
+	if err != nil {
+		slog.Error("error reading OpenHardwareMonitor sensors", "err", err)
+	}
+	w.status.collect(ch, begin, err)
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// wmiSupported tells whether WMI can be queried on this platform.
+const wmiSupported = false
+
+func (w *WmiCollector) collect(ch chan<- prometheus.Metric) error {
+	return errors.New("WMI is only supported on Windows")
+}
@@ -0,0 +1,58 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yusufpapurcu/wmi"
+)
+
+// wmiSupported tells whether WMI can be queried on this platform.
+const wmiSupported = true
+
+const ohmNamespace = `root\OpenHardwareMonitor`
+
+// ohmHardware and ohmSensor mirror the Hardware and Sensor WMI classes of
+// OpenHardwareMonitor.
+type ohmHardware struct {
+	Identifier   string
+	Name         string
+	HardwareType string
+}
+
+type ohmSensor struct {
+	Name       string
+	SensorType string
+	Parent     string
+	Value      float32
+}
+
+func (w *WmiCollector) collect(ch chan<- prometheus.Metric) error {
+	var hardware []ohmHardware
+	if err := wmi.QueryNamespace("SELECT Identifier, Name, HardwareType FROM Hardware", &hardware, ohmNamespace); err != nil {
+		return fmt.Errorf("error querying %s, is OpenHardwareMonitor running? %v", ohmNamespace, err)
+	}
+	byIdentifier := make(map[string]ohmHardware)
+	for _, h := range hardware {
+		byIdentifier[h.Identifier] = h
+	}
+
+	var sensors []ohmSensor
+	if err := wmi.QueryNamespace("SELECT Name, SensorType, Parent, Value FROM Sensor", &sensors, ohmNamespace); err != nil {
+		return fmt.Errorf("error querying %s, is OpenHardwareMonitor running? %v", ohmNamespace, err)
+	}
+	for _, s := range sensors {
+		desc, ok := wmiSensorDescs[s.SensorType]
+		if !ok {
+			continue
+		}
+		h := byIdentifier[s.Parent]
+		ch <- prometheus.MustNewConstMetric(desc,
+			prometheus.GaugeValue,
+			float64(s.Value),
+			s.Name, h.Name, h.HardwareType, s.Parent)
+	}
+	return nil
+}